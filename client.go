@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,12 +11,21 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 var (
 	ErrTest = errors.New("testing")
 	client  = &http.Client{Timeout: time.Second}
+
+	errBadOrderField = errors.New("ErrorBadOrderField") // reported with OrderField of request by FindUsers
+
+	ErrForbidden    = errors.New("forbidden") // AccessToken is valid, but lacks scope of the request
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user exists")           // CreateUser with Id of another user
+	ErrUserModified = errors.New("user modified")         // ETag is not the current one, user has been changed since it was read
+	ErrRegexTimeout = errors.New("regex match timed out") // QueryModeRegex took too long on the external system
 )
 
 type User struct {
@@ -26,12 +37,130 @@ type User struct {
 }
 
 type SearchResponse struct {
-	Users    []User
-	NextPage bool
+	Users      []User
+	NextPage   bool
+	Highlights []Highlight // aligned with Users, only when SearchRequest.Highlight is set
+	Scores     []float64   // aligned with Users, only for OrderFieldRelevance
+	Facets     []Facet     // counted over all matched users, not only this page
+	// Alternative spellings of Query when it finds few users, only when SearchRequest.SuggestDistance is set
+	Suggestions []string
+	Details     []UserDetails // aligned with Users, only for ResponseVersionDetails
+}
+
+// UserDetails is a full record of external system. Fields not requested with SearchRequest.Fields are zero.
+type UserDetails struct {
+	User
+	Guid          string
+	IsActive      bool
+	Balance       Amount
+	Picture       string
+	EyeColor      string
+	Company       string
+	Email         string
+	Phone         string
+	Address       string
+	Registered    time.Time
+	FavoriteFruit string
+}
+
+// Amount is an exact decimal money amount in cents, external system sends it as a string ( e.g. "2144.93" )
+type Amount int64
+
+func (a Amount) String() string {
+	sign, cents := "", int64(a)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// Decimal amount as it is sent by external system: rules of searchserver.ParseAmount without "$" and separators.
+func (a *Amount) UnmarshalText(text []byte) error {
+	negative := strings.HasPrefix(string(text), "-")
+	units, fraction, hasFraction := strings.Cut(strings.TrimPrefix(string(text), "-"), ".")
+	cents, err := strconv.ParseInt(units+(fraction + "00")[:2], 10, 64)
+	if err != nil || !isDigits(units) || len(fraction) > 2 || hasFraction && !isDigits(fraction) {
+		return fmt.Errorf("invalid amount %q", text)
+	}
+	if negative {
+		cents = -cents
+	}
+	*a = Amount(cents)
+	return nil
+}
+
+// Not empty and ASCII digits only.
+func isDigits(text string) bool {
+	return text != "" && strings.Trim(text, "0123456789") == ""
+}
+
+// UserRecord is a user as it is created and updated in external system, names are separate.
+type UserRecord struct {
+	Id            int `json:",omitempty"` // assigned by external system on create if 0
+	FirstName     string
+	LastName      string
+	Age           int
+	About         string
+	Gender        string
+	Guid          string
+	IsActive      bool
+	Balance       Amount
+	Picture       string
+	EyeColor      string
+	Company       string
+	Email         string
+	Phone         string
+	Address       string
+	Registered    time.Time
+	FavoriteFruit string
+	ETag          string `json:"-"` // version of user, changes are rejected with ErrUserModified if it is outdated
+}
+
+// Facet is a count of matched users by field in buckets
+type Facet struct {
+	Field    string
+	Interval int `json:",omitempty"` // bucket width for FacetAge
+	Buckets  []FacetBucket
+}
+
+type FacetBucket struct {
+	Value string `json:",omitempty"` // FacetGender value
+	From  int    `json:",omitempty"` // FacetAge bucket is [From, To)
+	To    int    `json:",omitempty"`
+	Count int
+}
+
+// Highlight explains why user was found. Ranges are [start, end) byte offsets in the original field value.
+type Highlight struct {
+	Name    [][2]int `json:",omitempty"`
+	About   [][2]int `json:",omitempty"`
+	Snippet string   `json:",omitempty"` // About around first match, matches are wrapped with markers
+}
+
+// Suggestion is a first, last or full name starting with requested prefix
+type Suggestion struct {
+	Text  string
+	Count int // number of users having this name
+}
+
+// searchResult is the response of external system when extras ( e.g. highlights ) are requested,
+// otherwise plain list of users is returned
+type searchResult struct {
+	Users       json.RawMessage // []User or []UserDetails
+	Highlights  []Highlight
+	Scores      []float64
+	Facets      []Facet
+	Suggestions []string `json:"suggestions"`
 }
 
 type SearchErrorResponse struct {
-	Error string
+	Error  string
+	Detail string `json:",omitempty"` // offending value, if any ( e.g. unknown field name )
+	Pos    int    `json:",omitempty"` // 1-based position of query syntax error
 }
 
 const (
@@ -39,7 +168,25 @@ const (
 	OrderByAsIs = 0
 	OrderByDesc = 1
 
+	OrderFieldRelevance = "Relevance" // BM25 score of Query words in Name and About, see Boosts
+
 	ErrorBadOrderField = `OrderField invalid`
+	ErrorBadField      = `ErrorBadField`
+	ErrorBadQuery      = `ErrorBadQuery`
+
+	QueryModeSubstring = "substring" // default: Query is a plain substring
+	QueryModeBoolean   = "boolean"   // Query is parsed, see Query for syntax
+	QueryModeRegex     = "regex"     // Query is RE2 regular expression, see regexp/syntax
+
+	MatchModeExact           = "exact"            // default
+	MatchModeCaseInsensitive = "case_insensitive" // Unicode case folding
+	MatchModeFolded          = "folded"           // case folding and diacritics stripping: "jose" matches "José"
+
+	FacetGender = "gender" // buckets by value, most frequent first
+	FacetAge    = "age"    // histogram, buckets of Interval years
+
+	ResponseVersionUser    = 1 // default: users are User records
+	ResponseVersionDetails = 2 // users are UserDetails records, see SearchResponse.Details
 )
 
 type SearchRequest struct {
@@ -48,6 +195,68 @@ type SearchRequest struct {
 	Query      string // substring in 1 of the fields
 	OrderField string
 	OrderBy    int
+	Fields     []string // subset of User fields to return, all fields if empty
+	Filters    Filters  // combined with Query using AND semantics
+	QueryMode  string   // how Query is interpreted, QueryModeSubstring if empty
+	MatchMode  string   // how Query terms are compared with user fields, MatchModeExact if empty
+	// Max edit distance between Query words and Name words, fuzzy search is off if 0.
+	// Fuzzy search ignores case and diacritics, result is ranked by distance.
+	Fuzziness int
+	Highlight *HighlightOptions // match highlighting is off if nil
+	Boosts    Boosts            // field weights for OrderFieldRelevance
+	Facets    []FacetRequest
+	// Max edit distance between misspelled Query words and Name/About words for spelling suggestions, off if 0
+	SuggestDistance int
+	// ResponseVersionDetails fills SearchResponse.Details, Fields can list UserDetails fields then.
+	// ResponseVersionUser if 0
+	ResponseVersion int
+}
+
+// FacetRequest asks external system to count matched users by field
+type FacetRequest struct {
+	Field    string // FacetGender or FacetAge
+	Interval int    // bucket width for FacetAge, 10 if 0
+}
+
+// Boosts are weights of fields in relevance score. Zero values are replaced with defaults of external system:
+// 2 for Name and 1 for About.
+type Boosts struct {
+	Name  float64
+	About float64
+}
+
+// HighlightOptions enables match highlighting. Zero values are replaced with defaults of external system.
+type HighlightOptions struct {
+	PreTag        *string // "<em>" if nil, can be empty
+	PostTag       *string // "</em>" if nil, can be empty
+	SnippetLength int     // characters, 160 by default
+}
+
+// Filters narrow down search result. Zero values are not applied.
+type Filters struct {
+	AgeMin int
+	AgeMax int
+	Gender string // male or female
+	Ids    []int
+}
+
+// InvalidFieldError is returned when SearchRequest.Fields contains a field unknown to the external system
+type InvalidFieldError struct {
+	Field string
+}
+
+func (e *InvalidFieldError) Error() string {
+	return fmt.Sprintf("Field %s invalid", e.Field)
+}
+
+// QuerySyntaxError is returned when external system fails to parse Query in QueryModeBoolean
+type QuerySyntaxError struct {
+	Pos int // 1-based, counted in characters
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
 }
 
 type SearchClient struct {
@@ -57,6 +266,20 @@ type SearchClient struct {
 	URL string
 }
 
+// RateLimitedError is returned when external system rejects request with 429 Too Many Requests
+type RateLimitedError struct {
+	RetryAfter time.Duration // from Retry-After header, 0 if it is missing
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+func rateLimitedError(resp *http.Response) error {
+	seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After")) // HTTP date is not sent by SearchServer
+	return &RateLimitedError{RetryAfter: time.Duration(max(seconds, 0)) * time.Second}
+}
+
 // FindUsers sends a request to an external system that directly searches for users
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
@@ -80,6 +303,44 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("query", req.Query)
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
+	if len(req.Fields) > 0 {
+		searcherParams.Add("fields", strings.Join(req.Fields, ","))
+	}
+	addFilterParams(searcherParams, &req.Filters)
+	if req.QueryMode != "" {
+		searcherParams.Add("query_mode", req.QueryMode)
+	}
+	if req.MatchMode != "" {
+		searcherParams.Add("match_mode", req.MatchMode)
+	}
+	if req.Fuzziness != 0 {
+		searcherParams.Add("fuzziness", strconv.Itoa(req.Fuzziness))
+	}
+	if req.Highlight != nil {
+		addHighlightParams(searcherParams, req.Highlight)
+	}
+	if req.Boosts.Name != 0 {
+		searcherParams.Add("boost_name", strconv.FormatFloat(req.Boosts.Name, 'g', -1, 64))
+	}
+	if req.Boosts.About != 0 {
+		searcherParams.Add("boost_about", strconv.FormatFloat(req.Boosts.About, 'g', -1, 64))
+	}
+	if len(req.Facets) > 0 {
+		facets := make([]string, len(req.Facets))
+		for i, facet := range req.Facets {
+			facets[i] = facet.Field
+			if facet.Interval != 0 {
+				facets[i] += ":" + strconv.Itoa(facet.Interval)
+			}
+		}
+		searcherParams.Add("facets", strings.Join(facets, ","))
+	}
+	if req.SuggestDistance != 0 {
+		searcherParams.Add("suggest_distance", strconv.Itoa(req.SuggestDistance))
+	}
+	if req.ResponseVersion != 0 {
+		searcherParams.Add("response_version", strconv.Itoa(req.ResponseVersion))
+	}
 
 	searcherReq, _ := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
 	searcherReq.Header.Add("AccessToken", srv.AccessToken)
@@ -94,36 +355,238 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(resp.Body)
 
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
-	case http.StatusBadRequest:
-		errResp := SearchErrorResponse{}
-		err = json.Unmarshal(body, &errResp)
-		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
-		}
-		if errResp.Error == "ErrorBadOrderField" {
+	if err := responseError(resp, body); err != nil {
+		if err == errBadOrderField {
 			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
 		}
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		return nil, err
 	}
 
-	data := []User{}
-	err = json.Unmarshal(body, &data)
+	data := searchResult{Users: body}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(body, &data)
+	}
+	users, details := []User{}, []UserDetails(nil)
+	if err == nil {
+		err = json.Unmarshal(data.Users, &users)
+	}
+	if err == nil && req.ResponseVersion == ResponseVersionDetails {
+		err = json.Unmarshal(data.Users, &details)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cant unpack result json: %s", err)
 	}
 
-	result := SearchResponse{}
-	if len(data) == req.Limit {
+	result := SearchResponse{Users: users, Highlights: data.Highlights, Scores: data.Scores, Facets: data.Facets,
+		Suggestions: data.Suggestions, Details: details}
+	if len(users) == req.Limit {
 		result.NextPage = true
-		result.Users = data[0 : len(data)-1]
-	} else {
-		result.Users = data
+		result.Users = users[0 : len(users)-1]
+		if len(data.Highlights) == len(users) {
+			result.Highlights = data.Highlights[0 : len(data.Highlights)-1]
+		}
+		if len(data.Scores) == len(users) {
+			result.Scores = data.Scores[0 : len(data.Scores)-1]
+		}
+		if len(details) == len(users) {
+			result.Details = details[0 : len(details)-1]
+		}
 	}
 
 	return &result, err
 }
+
+// Suggest returns up to n names starting with prefix, most frequent first. Case and diacritics are ignored.
+// Request goes to "suggest" next to URL of the external system.
+func (srv *SearchClient) Suggest(ctx context.Context, prefix string, n int) ([]Suggestion, error) {
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %s", srv.URL, err)
+	}
+	suggestURL := base.ResolveReference(&url.URL{Path: "suggest"})
+	suggestURL.RawQuery = url.Values{"prefix": {prefix}, "limit": {strconv.Itoa(n)}}.Encode()
+
+	suggestReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, suggestURL.String(), nil) // URL is parsed already
+	suggestReq.Header.Add("AccessToken", srv.AccessToken)
+
+	resp, err := client.Do(suggestReq)
+	if err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			return nil, fmt.Errorf("timeout for %s", suggestURL.RawQuery)
+		}
+		return nil, fmt.Errorf("unknown error %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if err := responseError(resp, body); err != nil {
+		return nil, err
+	}
+
+	suggestions := []Suggestion{}
+	if err := json.Unmarshal(body, &suggestions); err != nil {
+		return nil, fmt.Errorf("cant unpack result json: %s", err)
+	}
+	return suggestions, nil
+}
+
+// GetUser reads user by id. Request goes to "users/{id}" next to URL of the external system.
+func (srv *SearchClient) GetUser(ctx context.Context, id int) (*UserRecord, error) {
+	return srv.doUser(ctx, http.MethodGet, "users/"+strconv.Itoa(id), "", nil)
+}
+
+// CreateUser adds user, external system assigns Id if it is 0. Changes need an admin AccessToken.
+func (srv *SearchClient) CreateUser(ctx context.Context, user UserRecord) (*UserRecord, error) {
+	return srv.doUser(ctx, http.MethodPost, "users", "", &user)
+}
+
+// UpdateUser replaces all fields of user with Id. It fails with ErrUserModified if ETag is set and user has
+// been changed since it was read.
+func (srv *SearchClient) UpdateUser(ctx context.Context, user UserRecord) (*UserRecord, error) {
+	return srv.doUser(ctx, http.MethodPut, "users/"+strconv.Itoa(user.Id), user.ETag, &user)
+}
+
+// DeleteUser deletes user with id. It fails with ErrUserModified if etag is set and user has been changed.
+func (srv *SearchClient) DeleteUser(ctx context.Context, id int, etag string) error {
+	_, err := srv.doUser(ctx, http.MethodDelete, "users/"+strconv.Itoa(id), etag, nil)
+	return err
+}
+
+func (srv *SearchClient) doUser(ctx context.Context, method, path, etag string, user *UserRecord) (*UserRecord, error) {
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %s", srv.URL, err)
+	}
+	userURL := base.ResolveReference(&url.URL{Path: path})
+	var content io.Reader
+	if user != nil {
+		body, _ := json.Marshal(user) // fields of UserRecord always marshal
+		content = bytes.NewReader(body)
+	}
+
+	userReq, _ := http.NewRequestWithContext(ctx, method, userURL.String(), content) // URL is parsed already
+	userReq.Header.Add("AccessToken", srv.AccessToken)
+	if etag != "" {
+		userReq.Header.Add("If-Match", etag)
+	}
+
+	resp, err := client.Do(userReq)
+	if err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			return nil, fmt.Errorf("timeout for %s %s", method, path)
+		}
+		return nil, fmt.Errorf("unknown error %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusPreconditionFailed:
+		return nil, ErrUserModified
+	case http.StatusBadRequest: // what is invalid in user is told by detail
+		return nil, detailedError(body)
+	}
+	if err := responseError(resp, body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	record := UserRecord{}
+	if err := json.Unmarshal(body, &record); err != nil {
+		return nil, fmt.Errorf("cant unpack result json: %s", err)
+	}
+	record.ETag = resp.Header.Get("ETag")
+	return &record, nil
+}
+
+// Error of external system by response status, nil for success. Body of error is decoded where it tells more.
+func responseError(resp *http.Response, body []byte) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("Bad AccessToken")
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusTooManyRequests:
+		return rateLimitedError(resp)
+	case http.StatusInternalServerError:
+		return fmt.Errorf("SearchServer fatal error")
+	case http.StatusServiceUnavailable:
+		if errResp, err := decodeErrorResponse(body); err == nil && errResp.Error == ErrRegexTimeout.Error() {
+			return ErrRegexTimeout
+		}
+		return fmt.Errorf("SearchServer unavailable")
+	case http.StatusBadRequest:
+		errResp, err := decodeErrorResponse(body)
+		switch {
+		case err != nil:
+			return err
+		case errResp.Error == errBadOrderField.Error():
+			return errBadOrderField
+		case errResp.Error == ErrorBadField:
+			return &InvalidFieldError{Field: errResp.Detail}
+		case errResp.Error == ErrorBadQuery:
+			return &QuerySyntaxError{Pos: errResp.Pos, Msg: errResp.Detail}
+		}
+		return fmt.Errorf("unknown bad request error: %s", errResp.Error)
+	}
+	return detailedError(body)
+}
+
+// Error of body with its detail, if any.
+func detailedError(body []byte) error {
+	errResp, err := decodeErrorResponse(body)
+	switch {
+	case err != nil:
+		return err
+	case errResp.Error == ErrUserExists.Error():
+		return ErrUserExists
+	case errResp.Detail != "":
+		return fmt.Errorf("%s: %s", errResp.Error, errResp.Detail)
+	}
+	return errors.New(errResp.Error)
+}
+
+func decodeErrorResponse(body []byte) (*SearchErrorResponse, error) {
+	errResp := &SearchErrorResponse{}
+	if err := json.Unmarshal(body, errResp); err != nil {
+		return nil, fmt.Errorf("cant unpack error json: %s", err)
+	}
+	return errResp, nil
+}
+
+func addFilterParams(searcherParams url.Values, filters *Filters) {
+	if filters.AgeMin != 0 {
+		searcherParams.Add("age_min", strconv.Itoa(filters.AgeMin))
+	}
+	if filters.AgeMax != 0 {
+		searcherParams.Add("age_max", strconv.Itoa(filters.AgeMax))
+	}
+	if filters.Gender != "" {
+		searcherParams.Add("gender", filters.Gender)
+	}
+	if len(filters.Ids) > 0 {
+		ids := make([]string, len(filters.Ids))
+		for i, id := range filters.Ids {
+			ids[i] = strconv.Itoa(id)
+		}
+		searcherParams.Add("ids", strings.Join(ids, ","))
+	}
+}
+
+func addHighlightParams(searcherParams url.Values, options *HighlightOptions) {
+	searcherParams.Add("highlight", "true")
+	if options.PreTag != nil {
+		searcherParams.Add("highlight_pre", *options.PreTag)
+	}
+	if options.PostTag != nil {
+		searcherParams.Add("highlight_post", *options.PostTag)
+	}
+	if options.SnippetLength != 0 {
+		searcherParams.Add("snippet_length", strconv.Itoa(options.SnippetLength))
+	}
+}
@@ -1,216 +1,55 @@
 package main
 
 import (
-	"cmp"
-	"encoding/json"
-	"encoding/xml"
+	"context"
 	"errors"
-	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
-	"sort"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
+
+	"hw4/searchserver"
 )
 
 const (
 	AccessToken               = "AccessToken"
 	ValidToken                = "583-asgl-1s4gh-789b"
 	datasetPath               = "./dataset.xml"
-	ageField                  = "Age"
 	idField                   = "Id"
 	nameField                 = "Name"
+	maleGender                = "male"
+	femaleGender              = "female"
 	internalServerErorrMarker = "SIMULATE_INTERNAL_SERVER_ERROR"
 	replyInvalidJSON          = "REPLY_INVALID_JOSN"
 )
 
 var (
-	datasetUsers               Users
-	BadRequestError            error  = errors.New("ErrorBadOrderField")
-	OrderByInvalidError        error  = errors.New("invalid order_by")
-	InternalServerErrorContent []byte = []byte("{\"status\": 500, \"reason\": \"Internal Server Error\"}")
-	invalidJsonResponse               = []byte("{\"some': \"invalid\", }")
+	searchServer        http.Handler // searchserver.Server with test hooks, see SearchServer
+	invalidJsonResponse = []byte("{\"some': \"invalid\", }")
 )
 
-type Users struct {
-	Members []UserEntry `xml:"row"`
-	ready   bool
-}
-
-type UserEntry struct {
-	Id        int    `xml:"id"`
-	FirstName string `xml:"first_name"`
-	LastName  string `xml:"last_name"`
-	Age       int    `xml:"age"`
-	About     string `xml:"about"`
-	Gender    string `xml:"gender"`
-}
-
-func (ue UserEntry) toUser() User {
-	return User{Id: ue.Id, Age: ue.Age, About: ue.About, Name: ue.FirstName + " " + ue.LastName, Gender: ue.Gender}
-}
-
-// Parse xml file with users info.
-// Executed on init of test.
-func prepareSearchData() {
-	if datasetUsers.ready { // xml file was parsed already
-		return
-	}
-	data, err := os.ReadFile(datasetPath)
-	if err != nil { // handle any problem of file read
-		panic(fmt.Sprintf("error reading dataset file [%s]: %v", datasetPath, err))
-	}
-	parseResult := Users{Members: make([]UserEntry, 0, 40), ready: true}
-	err = xml.Unmarshal(data, &parseResult)
-	if err != nil || len(parseResult.Members) < 1 { // check errors and parse result
-		panic(fmt.Sprintf("error parsing xml [%s]: %v", datasetPath, err))
-	}
-	datasetUsers = parseResult
-}
-
-func produceErrorResponse(reason string) SearchErrorResponse {
-	return SearchErrorResponse{Error: reason}
-}
-
-func (e SearchErrorResponse) Msg() []byte {
-	if msg, err := json.Marshal(e); err != nil {
-		return InternalServerErrorContent
-	} else {
-		return msg
-	}
-}
-
-func authorize(r *http.Request) (reason string, isAuthorized bool) {
-	switch r.Header.Get(AccessToken) {
-	case internalServerErorrMarker:
-		panic("internal server error")
-	case ValidToken:
-		return "success", true
-	default:
-		return "invalid token", false
-	}
-}
-
-// Extract integer value of search param. Otherwise - handle error
-func getIntParam(vals url.Values, paramName string) (int, error) {
-	err_ := fmt.Errorf("invalid integer param [%s]", paramName)
-	if !vals.Has(paramName) {
-		return -1, err_
-	}
-	result, e := strconv.Atoi(vals.Get(paramName))
-	if e != nil {
-		return -1, err_
-	}
-	return result, nil
-}
-
-// Function validates request search params.
-// On empty search param - is valid ( use default).
-// Otherwise verify is search param listed in allowed values
-func validateAllowedValues(value interface{}, allowedValues ...interface{}) error {
-	for i := 0; i < len(allowedValues); i++ {
-		if value == allowedValues[i] {
-			return nil
-		}
-	}
-	return errors.New("invalid param")
-}
-
-func validateSearchParams(r *http.Request) (*SearchRequest, error) {
-	q := r.URL.Query()
-	limit, err := getIntParam(q, "limit")
-	if err != nil {
-		return nil, BadRequestError
-	}
-	offset, err := getIntParam(q, "offset")
-	if err != nil {
-		return nil, BadRequestError
-	}
-	orderBy, err := getIntParam(q, "order_by")
+func init() {
+	server, err := searchserver.New(searchserver.Config{DatasetPath: datasetPath, Tokens: []string{ValidToken}})
 	if err != nil {
-		return nil, BadRequestError
-	}
-
-	if err := validateAllowedValues(orderBy, OrderByAsc, OrderByAsIs, OrderByDesc); err != nil {
-		return nil, OrderByInvalidError
-	}
-	if err := validateAllowedValues(q.Get("order_field"), "", ageField, idField, nameField); err != nil {
-		return nil, errors.New("ErrorBadOrderField")
-	}
-	candidate := SearchRequest{Query: q.Get("query"), Limit: limit, Offset: offset, OrderField: q.Get("order_field"), OrderBy: orderBy}
-	return &candidate, nil
-}
-
-func handleErrorResponse(w http.ResponseWriter, status int, reason string) {
-	w.WriteHeader(status)
-	if _, err := w.Write(produceErrorResponse(reason).Msg()); err != nil {
-		panic("error to response")
-	}
-}
-
-// Build sort function based on order_field and order_by from search params.
-func resolveSortFunc(slice []User, searchParams *SearchRequest) func(i, j int) bool {
-	switch searchParams.OrderField {
-	default:
-		return func(i, j int) bool { return cmp.Compare(slice[i].Name, slice[j].Name) == searchParams.OrderBy }
-	case ageField:
-		return func(i, j int) bool { return cmp.Compare(slice[i].Age, slice[j].Age) == searchParams.OrderBy }
-	case idField:
-		return func(i, j int) bool { return cmp.Compare(slice[i].Id, slice[j].Id) == searchParams.OrderBy }
-	}
-}
-
-func sortUsersBeforeSearch(searchParams *SearchRequest, users []User) {
-	if searchParams.OrderBy == OrderByAsIs {
-		return
-	}
-	sort.Slice(users, resolveSortFunc(users, searchParams))
-}
-
-// Search predicate.
-func matches(user *User, searchParams *SearchRequest) bool {
-	return strings.Contains(user.Name, searchParams.Query) || strings.Contains(user.About, searchParams.Query)
-}
-
-func search(searchParams *SearchRequest, w http.ResponseWriter) {
-	if searchParams.Query == replyInvalidJSON { // siulate invalid JSON response on search result
-		w.WriteHeader(http.StatusOK)
-		n, err := w.Write(invalidJsonResponse)
-		if n != len(invalidJsonResponse) || err != nil {
-			panic("failed to process response")
-		}
-		return
-	}
-	searchCopy := make([]User, len(datasetUsers.Members)) // make a copy to keep original sequence between search requests
-	for i := 0; i < len(datasetUsers.Members); i++ {
-		searchCopy[i] = datasetUsers.Members[i].toUser()
-	}
-	searchResult := make([]User, 0, len(searchCopy))
-	for i := 0; i < len(searchCopy); i++ {
-		if matches(&searchCopy[i], searchParams) {
-			searchResult = append(searchResult, searchCopy[i])
+		panic(err)
+	}
+	searchServer = searchserver.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get(AccessToken) == internalServerErorrMarker:
+			panic("internal server error")
+		case r.URL.Query().Get("query") == replyInvalidJSON: // simulate invalid JSON response on search result
+			InvalidResponseHandler(w, r)
+		default:
+			server.ServeHTTP(w, r)
 		}
-	}
-	sortUsersBeforeSearch(searchParams, searchResult) // sort result if needed accordingly to search params
-	response, err := json.Marshal(searchResult)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusOK)
-	n, err := w.Write(response)
-	if n != len(response) || err != nil {
-		panic("failed to process response")
-	}
-}
-
-func init() {
-	prepareSearchData() // Prepare datastore.
+	}))
 }
 
 func InvalidJsonHandler(w http.ResponseWriter, r *http.Request) {
@@ -222,7 +61,7 @@ func InvalidJsonHandler(w http.ResponseWriter, r *http.Request) {
 
 func TimeOutHandler(w http.ResponseWriter, r *http.Request) {
 	time.Sleep(1100 * time.Millisecond)
-	handleErrorResponse(w, http.StatusGatewayTimeout, "gateway timed out")
+	w.WriteHeader(http.StatusGatewayTimeout)
 }
 
 func InvalidResponseHandler(w http.ResponseWriter, r *http.Request) {
@@ -233,26 +72,7 @@ func InvalidResponseHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func SearchServer(w http.ResponseWriter, r *http.Request) {
-	defer func(writer http.ResponseWriter) {
-		if r := recover(); r != nil {
-			handleErrorResponse(writer, http.StatusInternalServerError, "internal server error")
-			return
-		}
-	}(w)
-	// 1. authorize request.
-	if _, authorized := authorize(r); !authorized {
-		fmt.Println()
-		handleErrorResponse(w, http.StatusUnauthorized, "unauthorized")
-		return
-	}
-	// 2. validate search params.
-	searchParams, err := validateSearchParams(r)
-	if err != nil {
-		handleErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
-	}
-	// 3. search data -> handle errrors -> prodive response result.
-	search(searchParams, w)
+	searchServer.ServeHTTP(w, r)
 }
 
 func TestTimeOut(t *testing.T) {
@@ -321,3 +141,512 @@ func TestSucccessSearchServer(t *testing.T) {
 	}
 	ts.Close()
 }
+
+func TestFieldsProjection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	req, _ := http.NewRequest("GET", ts.URL+"?limit=1&offset=0&order_by=0&query=Boyd&fields=Gender,Id,Gender", nil)
+	req.Header.Add(AccessToken, ValidToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	// fields are returned in order of User struct, without duplicates
+	if expected := `[{"Id":0,"Gender":"male"}]`; string(body) != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+}
+
+func TestInvalidFieldError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	_, err := client.FindUsers(SearchRequest{Fields: []string{nameField, "Password"}})
+	var fieldErr *InvalidFieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("expected InvalidFieldError, got %#v", err)
+	}
+	if fieldErr.Field != "Password" {
+		t.Errorf("expected invalid field Password, got %s", fieldErr.Field)
+	}
+}
+
+func TestQueryBuilder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	cases := []struct {
+		query    Query
+		expected string
+	}{
+		{query: Term("Boyd"), expected: `Boyd`},
+		{query: FieldTerm(QueryFieldAbout, "commodo ex"), expected: `about:"commodo ex"`},
+		{query: Term(`say "hi" \ (or) OR`), expected: `"say \"hi\" \\ (or) OR"`},
+		{query: Term("OR"), expected: `"OR"`},
+		{query: And(Term("a"), Or(Term("b"), Term("c")), Not(And(Term("d"), Term("e")))), expected: `a AND (b OR c) AND NOT (d AND e)`},
+		{query: Or(Term("a"), And()), expected: `a`},
+	}
+	for caseNum, item := range cases {
+		if item.query.String() != item.expected {
+			t.Errorf("[%d] expected %s, got %s", caseNum, item.expected, item.query)
+		}
+		// everything built must be parsed by server
+		if _, err := client.FindUsers(SearchRequest{Query: item.query.String(), QueryMode: QueryModeBoolean}); err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+		}
+	}
+}
+
+func TestRegexTimeout(t *testing.T) {
+	server, err := searchserver.New(searchserver.Config{DatasetPath: datasetPath, Tokens: []string{ValidToken}, RegexMatchTimeout: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	_, err = client.FindUsers(SearchRequest{Query: "Boyd", QueryMode: QueryModeRegex})
+	if err != ErrRegexTimeout {
+		t.Errorf("expected regex timeout error, got %v", err)
+	}
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	client.URL = unavailable.URL
+	if _, err = client.FindUsers(SearchRequest{Query: "Boyd", QueryMode: QueryModeRegex}); err == nil || err.Error() != "SearchServer unavailable" {
+		t.Errorf("expected unavailable error, got %v", err)
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	pre, post, empty := "[", "]", ""
+	result, err := client.FindUsers(SearchRequest{Limit: 2, OrderBy: OrderByDesc, OrderField: idField, Query: "commodo e",
+		Fields: []string{idField}, Highlight: &HighlightOptions{PreTag: &pre, PostTag: &post, SnippetLength: 40}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// extra record for NextPage is dropped from highlights as well
+	expected := []Highlight{{About: [][2]int{{170, 179}}}, {About: [][2]int{{255, 264}, {324, 333}}}}
+	if !result.NextPage || len(result.Users) != 2 || len(result.Highlights) != len(expected) {
+		t.Fatalf("expected 2 users with highlights and next page, got %#v", result)
+	}
+	for i := range expected {
+		highlight := result.Highlights[i]
+		if !reflect.DeepEqual(expected[i].About, highlight.About) || highlight.Name != nil {
+			t.Errorf("[%d] expected highlight %v, got %v", i, expected[i], highlight)
+		}
+		if !strings.Contains(highlight.Snippet, "[commodo e]") || utf8.RuneCountInString(highlight.Snippet) > 40+4+2 {
+			t.Errorf("[%d] unexpected snippet %q", i, highlight.Snippet)
+		}
+	}
+
+	result, err = client.FindUsers(SearchRequest{Limit: 1, OrderBy: OrderByDesc, OrderField: idField, Query: "commodo e",
+		Fields: []string{idField}, Highlight: &HighlightOptions{PreTag: &empty, PostTag: &empty}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if snippet := result.Highlights[0].Snippet; !strings.Contains(snippet, " commodo e") || strings.Contains(snippet, "<em>") {
+		t.Errorf("expected snippet without markers, got %q", snippet)
+	}
+
+	result, err = client.FindUsers(SearchRequest{Limit: 5, Query: "name:boyd", QueryMode: QueryModeBoolean, MatchMode: MatchModeCaseInsensitive,
+		Highlight: &HighlightOptions{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []Highlight{{Name: [][2]int{{0, 4}}}}; !reflect.DeepEqual(expected, result.Highlights) {
+		t.Errorf("expected highlights %v, got %v", expected, result.Highlights)
+	}
+
+	result, err = client.FindUsers(SearchRequest{Limit: 5, Query: "Boyd"}) // no highlights unless requested
+	if err != nil || result.Highlights != nil {
+		t.Errorf("expected no highlights, got %v, %v", result, err)
+	}
+}
+
+func TestRelevanceOrder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	search := SearchRequest{Limit: 25, Query: "Boyd OR commodo", QueryMode: QueryModeBoolean, OrderField: OrderFieldRelevance,
+		Fields: []string{idField, nameField}}
+	result, err := client.FindUsers(search)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(result.Users) < 2 || len(result.Scores) != len(result.Users) {
+		t.Fatalf("expected users with scores, got %#v", result)
+	}
+	if result.Users[0].Name != "Boyd Wolf" { // the only one matching rare name word
+		t.Errorf("expected Boyd Wolf to be the most relevant, got %s", result.Users[0].Name)
+	}
+	for i := 1; i < len(result.Users); i++ {
+		if result.Scores[i] > result.Scores[i-1] || result.Scores[i] == result.Scores[i-1] && result.Users[i].Id < result.Users[i-1].Id {
+			t.Errorf("[%d] wrong order: %v (%f) goes after %v (%f)", i, result.Users[i], result.Scores[i], result.Users[i-1], result.Scores[i-1])
+		}
+	}
+
+	paged := search
+	paged.Limit, paged.Offset = 5, 5
+	page, err := client.FindUsers(paged)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// scores are aligned with page users, extra user for NextPage is dropped from scores as well
+	if !page.NextPage || !reflect.DeepEqual(result.Users[5:10], page.Users) || !reflect.DeepEqual(result.Scores[5:10], page.Scores) {
+		t.Errorf("expected second page of %v with scores %v, got %#v", result.Users[5:10], result.Scores[5:10], page)
+	}
+
+	search.OrderBy = OrderByAsc
+	ascending, err := client.FindUsers(search)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if last := ascending.Users[len(ascending.Users)-1]; last.Name != "Boyd Wolf" {
+		t.Errorf("expected Boyd Wolf to be the last in ascending order, got %s", last.Name)
+	}
+
+	search.OrderBy, search.Boosts = OrderByAsIs, Boosts{Name: 0.001}
+	unboosted, err := client.FindUsers(search)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if unboosted.Users[0].Name == "Boyd Wolf" { // name match doesn't outweigh frequent about matches anymore
+		t.Errorf("expected Boyd Wolf not to be the most relevant without name boost, got %v", unboosted.Users)
+	}
+}
+
+func TestFacets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	result, err := client.FindUsers(SearchRequest{Limit: 25, Query: "commodo", Fields: []string{idField},
+		Facets: []FacetRequest{{Field: FacetGender}, {Field: FacetAge}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []Facet{
+		{Field: FacetGender, Buckets: []FacetBucket{{Value: maleGender, Count: 10}, {Value: femaleGender, Count: 7}}},
+		{Field: FacetAge, Interval: 10, Buckets: []FacetBucket{{From: 20, To: 30, Count: 4}, {From: 30, To: 40, Count: 11}, {From: 40, To: 50, Count: 2}}},
+	}
+	if len(result.Users) != 17 || !reflect.DeepEqual(expected, result.Facets) {
+		t.Errorf("expected 17 users and facets %v, got %#v", expected, result)
+	}
+
+	result, err = client.FindUsers(SearchRequest{Limit: 2, Query: "commodo", Filters: Filters{Gender: femaleGender, AgeMin: 25, AgeMax: 35},
+		Facets: []FacetRequest{{Field: FacetAge, Interval: 5}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = []Facet{{Field: FacetAge, Interval: 5, Buckets: []FacetBucket{{From: 30, To: 35, Count: 3}, {From: 35, To: 40, Count: 1}}}}
+	if !reflect.DeepEqual(expected, result.Facets) {
+		t.Errorf("expected facets respecting filters %v, got %v", expected, result.Facets)
+	}
+}
+
+func TestSpellingSuggestionsResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	result, err := client.FindUsers(SearchRequest{Limit: 5, Query: "Boyd Wlof", SuggestDistance: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(result.Users) != 0 || !reflect.DeepEqual([]string{"Boyd Wolf"}, result.Suggestions) {
+		t.Errorf("expected no users and suggestion, got %#v", result)
+	}
+
+	result, err = client.FindUsers(SearchRequest{Limit: 5, Query: "Boyd Wlof"}) // suggestions are off by default
+	if err != nil || len(result.Users) != 0 || result.Suggestions != nil {
+		t.Errorf("expected no users and no suggestions, got %#v, %v", result, err)
+	}
+
+	result, err = client.FindUsers(SearchRequest{Limit: 5, Query: "Boyd", SuggestDistance: 2}) // nothing to correct
+	if err != nil || len(result.Users) != 1 || result.Suggestions != nil {
+		t.Errorf("expected Boyd without suggestions, got %#v, %v", result, err)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	suggestions, err := client.Suggest(context.Background(), "bo", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []Suggestion{{"Boyd", 1}, {"Boyd Wolf", 1}}; !reflect.DeepEqual(expected, suggestions) {
+		t.Errorf("expected suggestions %v, got %v", expected, suggestions)
+	}
+	if _, err := client.Suggest(context.Background(), " ", 3); err == nil || err.Error() != "unknown bad request error: prefix must not be empty" {
+		t.Errorf("expected empty prefix error, got %v", err)
+	}
+	if _, err := client.Suggest(context.Background(), "bo", 100); err == nil || err.Error() != "unknown bad request error: limit must be between 1 and 50" {
+		t.Errorf("expected limit error, got %v", err)
+	}
+	client.AccessToken = "invalid"
+	if _, err := client.Suggest(context.Background(), "bo", 3); err == nil || err.Error() != "Bad AccessToken" {
+		t.Errorf("expected authorization error, got %v", err)
+	}
+}
+
+func TestSuggestErrors(t *testing.T) {
+	cases := []struct {
+		handler http.HandlerFunc
+		err     string
+	}{
+		{handler: TimeOutHandler, err: "timeout for"},
+		{handler: InvalidJsonHandler, err: "cant unpack error json"},
+		{handler: InvalidResponseHandler, err: "cant unpack result json"},
+		{handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, err: "SearchServer fatal error"},
+	}
+	for caseNum, item := range cases {
+		ts := httptest.NewServer(item.handler)
+		client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+		if _, err := client.Suggest(context.Background(), "bo", 3); err == nil || !strings.HasPrefix(err.Error(), item.err) {
+			t.Errorf("[%d] expected error %s, got %v", caseNum, item.err, err)
+		}
+		ts.Close()
+	}
+	for _, url := range []string{"http://127.0.0.1:1234", "http://[::1"} {
+		client := SearchClient{AccessToken: ValidToken, URL: url}
+		if _, err := client.Suggest(context.Background(), "bo", 3); err == nil {
+			t.Errorf("expected error for %s, got nil", url)
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	if _, err := client.Suggest(ctx, "bo", 3); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("expected error of cancelled context, got %v", err)
+	}
+}
+
+func TestUserDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	result, err := client.FindUsers(SearchRequest{Limit: 2, OrderBy: OrderByAsc, OrderField: idField, QueryMode: QueryModeBoolean,
+		Query: "Boyd OR Hilda OR Brooks", ResponseVersion: ResponseVersionDetails, Highlight: &HighlightOptions{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !result.NextPage || len(result.Details) != 2 || len(result.Users) != 2 || len(result.Highlights) != 2 {
+		t.Fatalf("expected 2 users with details and next page, got %#v", result)
+	}
+	boyd := result.Details[0]
+	if boyd.User != result.Users[0] || boyd.Guid != "1a6fa827-62f1-45f6-b579-aaead2b47169" || boyd.IsActive ||
+		boyd.Balance.String() != "2144.93" || boyd.EyeColor != "green" || boyd.Phone != "+1 (956) 593-2402" ||
+		boyd.FavoriteFruit != "apple" || boyd.Picture != "http://placehold.it/32x32" || boyd.Address == "" {
+		t.Errorf("unexpected details %#v", boyd)
+	}
+	registered := time.Date(2017, 2, 5, 6, 23, 27, 0, time.FixedZone("", -3*60*60))
+	if !boyd.Registered.Equal(registered) {
+		t.Errorf("expected registered %s, got %s", registered, boyd.Registered)
+	}
+	if _, offset := boyd.Registered.Zone(); offset != -3*60*60 {
+		t.Errorf("expected offset of dataset to be kept, got %d", offset)
+	}
+}
+
+func TestAmount(t *testing.T) {
+	for text, expected := range map[string]Amount{"2144.93": 214493, "-1.5": -150, "0.07": 7, "-0.50": -50, "12": 1200} {
+		var amount Amount
+		if err := amount.UnmarshalText([]byte(text)); err != nil || amount != expected {
+			t.Errorf("%s: expected %d, got %d ( %v )", text, expected, amount, err)
+		}
+	}
+	for _, text := range []string{"", "-", ".5", "1.234", "$1.00", "1,000.00", "1.x", "1.", "+1", "--1", "1.-5", "-+1"} {
+		var amount Amount
+		if err := amount.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("%s: expected error, got %d", text, amount)
+		}
+	}
+	if text := Amount(-214493).String(); text != "-2144.93" {
+		t.Errorf("expected -2144.93, got %s", text)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	content, err := os.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server, err := searchserver.New(searchserver.Config{DatasetPath: path, Tokens: []string{ValidToken, "admin"},
+		AdminTokens: []string{"admin"}, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	ctx := context.Background()
+	client := SearchClient{AccessToken: "admin", URL: ts.URL}
+
+	registered := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	created, err := client.CreateUser(ctx, UserRecord{FirstName: "Floyd", LastName: "Wolf", Age: 30, Gender: maleGender,
+		Balance: 100050, Registered: registered})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if created.Id != 35 || created.Balance != 100050 || !created.Registered.Equal(registered) || created.ETag == "" {
+		t.Errorf("unexpected created user %#v", created)
+	}
+	result, err := client.FindUsers(SearchRequest{Limit: 10, Query: "Floyd"})
+	if err != nil || len(result.Users) != 1 || result.Users[0].Name != "Floyd Wolf" {
+		t.Errorf("expected created user to be found, got %#v ( %v )", result, err)
+	}
+	if _, err := client.CreateUser(ctx, *created); err != ErrUserExists {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+
+	stale := *created
+	created.Email = "floyd@example.com"
+	updated, err := client.UpdateUser(ctx, *created)
+	if err != nil || updated.Email != "floyd@example.com" || updated.ETag == created.ETag {
+		t.Fatalf("expected user to be updated, got %#v ( %v )", updated, err)
+	}
+	if _, err := client.UpdateUser(ctx, stale); err != ErrUserModified {
+		t.Errorf("expected ErrUserModified, got %v", err)
+	}
+	if err := client.DeleteUser(ctx, stale.Id, stale.ETag); err != ErrUserModified {
+		t.Errorf("expected ErrUserModified, got %v", err)
+	}
+	if read, err := client.GetUser(ctx, updated.Id); err != nil || !reflect.DeepEqual(read, updated) {
+		t.Errorf("expected %#v, got %#v ( %v )", updated, read, err)
+	}
+	if err := client.DeleteUser(ctx, updated.Id, updated.ETag); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.GetUser(ctx, updated.Id); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	if _, err := client.CreateUser(ctx, UserRecord{Gender: "cat"}); err == nil || err.Error() != `invalid user: invalid gender "cat"` {
+		t.Errorf("expected invalid user error, got %v", err)
+	}
+	client.AccessToken = ValidToken
+	if _, err := client.CreateUser(ctx, UserRecord{Gender: maleGender}); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+	client.AccessToken = "invalid"
+	if _, err := client.GetUser(ctx, 0); err == nil || err.Error() != "Bad AccessToken" {
+		t.Errorf("expected authorization error, got %v", err)
+	}
+}
+
+func TestUsersErrors(t *testing.T) {
+	cases := []struct {
+		handler http.HandlerFunc
+		err     string
+	}{
+		{handler: TimeOutHandler, err: "timeout for"},
+		{handler: InvalidJsonHandler, err: "cant unpack error json"},
+		{handler: InvalidResponseHandler, err: "cant unpack result json"},
+		{handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, err: "SearchServer fatal error"},
+		{handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"Error":"last user can't be deleted"}`)
+		}, err: "last user can't be deleted"},
+	}
+	for caseNum, item := range cases {
+		ts := httptest.NewServer(item.handler)
+		client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+		if _, err := client.GetUser(context.Background(), 0); err == nil || !strings.HasPrefix(err.Error(), item.err) {
+			t.Errorf("[%d] expected error %s, got %v", caseNum, item.err, err)
+		}
+		ts.Close()
+	}
+	for _, url := range []string{"http://127.0.0.1:1234", "http://[::1"} {
+		client := SearchClient{AccessToken: ValidToken, URL: url}
+		if err := client.DeleteUser(context.Background(), 0, ""); err == nil {
+			t.Errorf("expected error for %s, got nil", url)
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	if _, err := client.GetUser(ctx, 0); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("expected error of cancelled context, got %v", err)
+	}
+}
+
+func TestForbidden(t *testing.T) {
+	store, err := searchserver.NewTokenStore([]searchserver.Token{
+		{Name: "search", Hash: searchserver.HashToken(ValidToken), Scopes: []string{searchserver.ScopeSearch}},
+		{Name: "write", Hash: searchserver.HashToken("write"), Scopes: []string{searchserver.ScopeWrite}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server, err := searchserver.New(searchserver.Config{DatasetPath: datasetPath, TokenStore: store})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := client.FindUsers(SearchRequest{Limit: 1, ResponseVersion: ResponseVersionDetails}); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden for details, got %v", err)
+	}
+	if _, err := client.GetUser(context.Background(), 0); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden for user, got %v", err)
+	}
+	client.AccessToken = "write"
+	if _, err := client.Suggest(context.Background(), "bo", 3); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden for suggestions, got %v", err)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	server, err := searchserver.New(searchserver.Config{DatasetPath: datasetPath, Tokens: []string{ValidToken},
+		TokenRateLimit: searchserver.RateLimit{Rate: 0.01, Burst: 1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := SearchClient{AccessToken: ValidToken, URL: ts.URL}
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	var limited *RateLimitedError
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); !errors.As(err, &limited) || limited.RetryAfter != 100*time.Second {
+		t.Errorf("expected rate limit for 100s, got %v", err)
+	} else if err.Error() != "rate limited, retry after 1m40s" {
+		t.Errorf("unexpected message %s", err)
+	}
+	if _, err := client.Suggest(context.Background(), "bo", 3); !errors.As(err, &limited) {
+		t.Errorf("expected rate limit for suggestions, got %v", err)
+	}
+	if _, err := client.GetUser(context.Background(), 0); !errors.As(err, &limited) {
+		t.Errorf("expected rate limit for user, got %v", err)
+	}
+
+	// Retry-After is optional
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+	client.URL = ts.URL
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); !errors.As(err, &limited) || limited.RetryAfter != 0 {
+		t.Errorf("expected rate limit without delay, got %v", err)
+	}
+}
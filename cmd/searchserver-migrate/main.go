@@ -0,0 +1,60 @@
+// Command searchserver-migrate imports dataset file into SQLite table served by searchserver -db.
+//
+//	go run ./cmd/searchserver-migrate -dataset dataset.xml -db users.db -table users
+//
+// Table is created if it doesn't exist, its users are replaced with users of dataset in one transaction.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+
+	_ "modernc.org/sqlite"
+
+	"hw4/searchserver"
+)
+
+func main() {
+	datasetPath := flag.String("dataset", "dataset.xml", "path to dataset file")
+	datasetFormat := flag.String("format", "", "dataset format: xml, json, jsonl or csv ( default by extension of -dataset )")
+	dbPath := flag.String("db", "users.db", "path to SQLite database")
+	table := flag.String("table", "users", "table of users")
+	flag.Parse()
+
+	if err := run(*datasetPath, *datasetFormat, *dbPath, *table); err != nil {
+		log.Fatalf("failed to migrate: %s", err)
+	}
+}
+
+// Deferred close of database runs before the error is reported.
+func run(datasetPath, datasetFormat, dbPath, table string) error {
+	file, err := searchserver.NewFileRepository(datasetPath, datasetFormat)
+	if err != nil {
+		return err
+	}
+	users, err := file.Users(0)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer db.Close()
+	repository, err := searchserver.NewSQLRepository(db, table)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := repository.Migrate(ctx); err != nil {
+		return fmt.Errorf("error creating table %s: %w", table, err)
+	}
+	if err := repository.Save(ctx, users); err != nil {
+		return fmt.Errorf("error importing users into %s: %w", table, err)
+	}
+	log.Printf("imported %d users of %s into %s table of %s", len(users), datasetPath, table, dbPath)
+	return nil
+}
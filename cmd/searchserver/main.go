@@ -0,0 +1,199 @@
+// Command searchserver runs SearchServer over dataset.xml as a standalone http service.
+//
+//	go run ./cmd/searchserver -addr :8080 -dataset dataset.xml -tokens 583-asgl-1s4gh-789b
+//
+// Tokens can also be passed with SEARCHSERVER_TOKENS ( and SEARCHSERVER_ADMIN_TOKENS ) environment variables
+// to keep them out of process list, or with -tokens-file having names, scopes and expiry of salted hashes of
+// tokens ( -hash-token prints a hash for it ), which can't be combined with the others. With -jwks signed
+// tokens of Authorization: Bearer header are accepted as well. Dataset and JWKS files is checked for changes
+// every -reload-interval.
+//
+// With -db users are read from SQLite table instead ( see cmd/searchserver-migrate ), plain searches are
+// answered by SQL.
+//
+// With -wal users are kept in memory and changes of /users endpoints are logged to the directory, the dataset
+// ( or -db table ) only makes its first snapshot.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"hw4/searchserver"
+)
+
+const (
+	tokensEnv      = "SEARCHSERVER_TOKENS"
+	adminTokensEnv = "SEARCHSERVER_ADMIN_TOKENS"
+)
+
+func splitTokens(value string) []string {
+	tokens := []string{}
+	for _, token := range strings.Split(value, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	datasetPath := flag.String("dataset", "dataset.xml", "path to dataset file")
+	datasetFormat := flag.String("format", "", "dataset format: xml, json, jsonl or csv ( default by extension of -dataset )")
+	dbPath := flag.String("db", "", "path to SQLite database to read users from instead of -dataset")
+	table := flag.String("table", "users", "table of users in -db")
+	walDir := flag.String("wal", "", "directory of write-ahead log and snapshots of changed users")
+	walSync := flag.String("wal-sync", searchserver.SyncAlways, "when log is flushed to disk: always, interval or never")
+	walSyncInterval := flag.Duration("wal-sync-interval", time.Second, "how often log is flushed with -wal-sync interval")
+	snapshotRecords := flag.Int("snapshot-records", 1000, "log records compacted into a snapshot")
+	tokens := flag.String("tokens", os.Getenv(tokensEnv), "comma-separated list of accepted access tokens ( default $"+tokensEnv+" )")
+	readTimeout := flag.Duration("read-timeout", 5*time.Second, "max duration of reading request")
+	writeTimeout := flag.Duration("write-timeout", 10*time.Second, "max duration of writing response")
+	idleTimeout := flag.Duration("idle-timeout", time.Minute, "max time to wait for the next request on keep-alive connection")
+	tokensFile := flag.String("tokens-file", "", "JSON file of tokens with scopes, instead of -tokens and -admin-tokens")
+	hashToken := flag.String("hash-token", "", "print salted hash of the token for -tokens-file and exit")
+	jwksPath := flag.String("jwks", "", "JWKS file with HS256 and Ed25519 keys of accepted bearer tokens")
+	jwtIssuer := flag.String("jwt-issuer", "", "required iss claim of bearer tokens")
+	jwtAudience := flag.String("jwt-audience", "", "required aud claim of bearer tokens")
+	jwtClockSkew := flag.Duration("jwt-clock-skew", time.Minute, "tolerance of exp and nbf claims")
+	rate := flag.Float64("rate", 0, "requests per second of every token, 0 for unlimited")
+	burst := flag.Int("burst", 10, "requests of every token at once with -rate")
+	ipRate := flag.Float64("ip-rate", 0, "requests per second of every client IP, 0 for unlimited")
+	ipBurst := flag.Int("ip-burst", 20, "requests of every client IP at once with -ip-rate")
+	accessLog := flag.String("access-log", searchserver.AccessLogText, "format of access log on stderr: json, text or off")
+	accessLogSample := flag.Int("access-log-sample", 1, "log every Nth successful request")
+	slowRequest := flag.Duration("slow-request", time.Second, "requests slower than this are always logged, 0 to disable")
+	adminTokens := flag.String("admin-tokens", os.Getenv(adminTokensEnv),
+		"comma-separated list of access tokens for /admin/ endpoints ( default $"+adminTokensEnv+" )")
+	reloadInterval := flag.Duration("reload-interval", 5*time.Second, "how often dataset file is checked for changes, 0 to disable")
+	maxLimit := flag.Int("max-limit", 100, "max users per page")
+	maxRows := flag.Int("max-rows", 0, "max users in dataset file, 0 for unlimited")
+	regexTimeout := flag.Duration("regex-timeout", 200*time.Millisecond, "max duration of matching regex query")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 5*time.Second, "max time to finish active requests on shutdown")
+	flag.Parse()
+	if *hashToken != "" {
+		fmt.Println(searchserver.HashToken(*hashToken))
+		return
+	}
+
+	config := searchserver.Config{DatasetPath: *datasetPath, DatasetFormat: *datasetFormat, Tokens: splitTokens(*tokens), RegexMatchTimeout: *regexTimeout,
+		MaxLimit: *maxLimit, AdminTokens: splitTokens(*adminTokens), ReloadInterval: *reloadInterval, MaxRows: *maxRows,
+		TokenRateLimit: searchserver.RateLimit{Rate: *rate, Burst: *burst}, IPRateLimit: searchserver.RateLimit{Rate: *ipRate, Burst: *ipBurst}}
+	if *tokensFile != "" {
+		if len(config.Tokens) > 0 || len(config.AdminTokens) > 0 { // they would be ignored
+			log.Fatalf("failed to start: -tokens-file can't be used with -tokens, -admin-tokens, %s or %s", tokensEnv, adminTokensEnv)
+		}
+		store, err := searchserver.LoadTokenStore(*tokensFile)
+		if err != nil {
+			log.Fatalf("failed to start: %s", err)
+		}
+		config.TokenStore = store
+	} else if len(config.Tokens) == 0 && *jwksPath == "" {
+		log.Fatalf("no access tokens configured: use -tokens, %s, -tokens-file or -jwks", tokensEnv)
+	}
+	if *jwksPath != "" {
+		verifier, err := searchserver.NewJWTVerifier(searchserver.JWTConfig{JWKSPath: *jwksPath, Issuer: *jwtIssuer,
+			Audience: *jwtAudience, ClockSkew: *jwtClockSkew})
+		if err != nil {
+			log.Fatalf("failed to start: %s", err)
+		}
+		config.JWT = verifier
+	}
+	var closers []io.Closer // of database and log, closed on exit
+	defer func() { closeAll(closers) }()
+	fatalf := func(format string, args ...interface{}) { // log.Fatalf alone skips deferred calls
+		closeAll(closers)
+		log.Fatalf(format, args...)
+	}
+	source := *datasetPath
+	if *dbPath != "" {
+		db, err := sql.Open("sqlite", *dbPath)
+		if err != nil {
+			fatalf("failed to open database: %s", err)
+		}
+		closers = append(closers, db)
+		if config.Repository, err = searchserver.NewSQLRepository(db, *table); err != nil {
+			fatalf("failed to start: %s", err)
+		}
+		source = *table + " table of " + *dbPath
+	}
+	if *walDir != "" {
+		seed := config.Repository
+		if seed == nil {
+			repository, err := searchserver.NewFileRepository(*datasetPath, *datasetFormat)
+			if err != nil {
+				fatalf("failed to start: %s", err)
+			}
+			seed = repository
+		}
+		wal, err := searchserver.NewWALRepository(*walDir, seed, searchserver.WALOptions{Sync: *walSync,
+			SyncInterval: *walSyncInterval, SnapshotRecords: *snapshotRecords})
+		if err != nil {
+			fatalf("failed to recover users: %s", err)
+		}
+		closers = append(closers, wal)
+		if wal.Recovery.Dropped > 0 {
+			log.Printf("dropped %d bytes of torn log tail", wal.Recovery.Dropped)
+		}
+		config.Repository = wal
+		source = fmt.Sprintf("log %s ( %d records replayed )", *walDir, wal.Recovery.Records)
+	}
+	handler, err := searchserver.New(config)
+	if err != nil {
+		fatalf("failed to start: %s", err)
+	}
+	accessLogConfig := searchserver.AccessLogConfig{SampleSuccess: *accessLogSample, SlowThreshold: *slowRequest}
+	if *accessLog != "off" {
+		if accessLogConfig.Logger, err = searchserver.NewAccessLogger(os.Stderr, *accessLog); err != nil {
+			fatalf("failed to start: %s", err)
+		}
+	}
+	server := &http.Server{
+		Addr:         *addr,
+		Handler:      searchserver.AccessLog(handler, accessLogConfig),
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go handler.Watch(ctx)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("searching %s on %s", source, *addr)
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		fatalf("failed to serve: %s", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %s", err)
+	}
+}
+
+// Close in reverse order: log is flushed ( unsynced records of -wal-sync interval ) before database is closed.
+func closeAll(closers []io.Closer) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			log.Printf("failed to close: %s", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	QueryFieldName  = "name"
+	QueryFieldAbout = "about"
+)
+
+// Query builds query string for QueryModeBoolean, terms are quoted and escaped when needed.
+//
+//	Or(FieldTerm(QueryFieldName, "Boyd"), And(Term("commodo ex"), Not(Term("Lorem")))).String()
+//	// name:Boyd OR ("commodo ex" AND NOT Lorem)
+type Query struct {
+	expr     string
+	compound bool // must be put in parentheses when nested
+}
+
+// Term matches substring in any of Name and About
+func Term(text string) Query {
+	return Query{expr: quoteTerm(text)}
+}
+
+// FieldTerm matches substring in given field only
+func FieldTerm(field, text string) Query {
+	return Query{expr: field + ":" + quoteTerm(text)}
+}
+
+func And(queries ...Query) Query {
+	return joinQueries(" AND ", queries)
+}
+
+func Or(queries ...Query) Query {
+	return joinQueries(" OR ", queries)
+}
+
+func Not(query Query) Query {
+	return Query{expr: "NOT " + query.nested()}
+}
+
+func (q Query) String() string {
+	return q.expr
+}
+
+func (q Query) nested() string {
+	if q.compound {
+		return "(" + q.expr + ")"
+	}
+	return q.expr
+}
+
+// Empty queries are skipped, single query is returned as is
+func joinQueries(operator string, queries []Query) Query {
+	parts := make([]string, 0, len(queries))
+	for _, query := range queries {
+		if query.expr != "" {
+			parts = append(parts, query.nested())
+		}
+	}
+	if len(parts) == 1 {
+		return Query{expr: parts[0]}
+	}
+	return Query{expr: strings.Join(parts, operator), compound: len(parts) > 1}
+}
+
+// Bare word is kept as is, anything else is put in quotes with \ and " escaped
+func quoteTerm(text string) string {
+	bare := text != "" && text != "AND" && text != "OR" && text != "NOT" &&
+		strings.IndexFunc(text, func(r rune) bool { return unicode.IsSpace(r) || strings.ContainsRune(`()":\`, r) }) < 0
+	if bare {
+		return text
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
@@ -0,0 +1,159 @@
+package searchserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	AccessLogJSON = "json"
+	AccessLogText = "text"
+
+	requestIDHeader    = "X-Request-Id"
+	maxRequestIDLength = 64
+)
+
+type AccessLogConfig struct {
+	Logger        *slog.Logger  // no access log if nil ( see NewAccessLogger )
+	SampleSuccess int           // every Nth request with status below 400 is logged, all if 0 or 1
+	SlowThreshold time.Duration // slower requests are logged with warning level despite sampling, off if 0
+}
+
+// NewAccessLogger writes records to w in one of AccessLog* formats.
+func NewAccessLogger(w io.Writer, format string) (*slog.Logger, error) {
+	if err := validateAllowedValues(format, AccessLogJSON, AccessLogText); err != nil {
+		return nil, fmt.Errorf("access log format: %w", err)
+	}
+	if format == AccessLogJSON {
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, nil)), nil
+}
+
+type accessLogKey struct{}
+
+// accessEntry is filled by handlers down the chain, Server notes the token name there.
+type accessEntry struct {
+	requestID string
+	tokenName string
+}
+
+// Token name of the request for access log, if request goes through AccessLog.
+func noteTokenName(r *http.Request, name string) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessEntry); ok {
+		entry.tokenName = name
+	}
+}
+
+// RequestID of the request going through AccessLog, empty otherwise.
+func RequestID(ctx context.Context) string {
+	if entry, ok := ctx.Value(accessLogKey{}).(*accessEntry); ok {
+		return entry.requestID
+	}
+	return ""
+}
+
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(content []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(content)
+	w.bytes += n
+	return n, err
+}
+
+// AccessLog logs every request of next after it is served. Request ID is taken from X-Request-Id header
+// or generated, and is sent back in the same header. Token itself is never logged, only its name.
+func AccessLog(next http.Handler, config AccessLogConfig) http.Handler {
+	if config.Logger == nil {
+		return next
+	}
+	var successes atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{requestID: requestID(r)}
+		w.Header().Set(requestIDHeader, entry.requestID)
+		writer := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(writer, r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry)))
+		latency := time.Since(start)
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+
+		slow := config.SlowThreshold > 0 && latency >= config.SlowThreshold
+		level := slog.LevelInfo
+		switch {
+		case writer.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case slow:
+			level = slog.LevelWarn
+		case writer.status < http.StatusBadRequest && config.SampleSuccess > 1 &&
+			(successes.Add(1)-1)%int64(config.SampleSuccess) != 0:
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("query", normalizeQuery(r.URL.RawQuery)),
+			slog.Int("status", writer.status),
+			slog.Int("bytes", writer.bytes),
+			slog.Duration("latency", latency),
+			slog.String("request_id", entry.requestID),
+			slog.String("token", entry.tokenName),
+		}
+		if slow {
+			attrs = append(attrs, slog.Bool("slow", true))
+		}
+		config.Logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// Request ID of client if it is short and printable, a new random one otherwise.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	valid := id != "" && len(id) <= maxRequestIDLength && strings.IndexFunc(id, func(c rune) bool {
+		return c <= ' ' || c > '~'
+	}) < 0
+	if valid {
+		return id
+	}
+	random := make([]byte, 16)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// Parameters sorted by name with canonical escaping, values of parameters named like a token are
+// replaced. Malformed pairs are dropped.
+func normalizeQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	for name, list := range values {
+		if strings.Contains(strings.ToLower(name), "token") {
+			for i := range list {
+				list[i] = "REDACTED"
+			}
+		}
+	}
+	return values.Encode()
+}
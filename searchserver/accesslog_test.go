@@ -0,0 +1,104 @@
+package searchserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewAccessLogger(&out, AccessLogJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	handler := AccessLog(newUsersTestServer(t, Config{}), AccessLogConfig{Logger: logger})
+	request := func(target, token, requestID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set(accessTokenHeader, token)
+		if requestID != "" {
+			r.Header.Set(requestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	cases := []struct {
+		target, token, requestID string
+		expected                 map[string]interface{}
+	}{
+		{"/?order_by=0&offset=0&limit=1&access_token=secret", "token", "req-1", map[string]interface{}{"level": "INFO",
+			"method": "GET", "path": "/", "query": "access_token=REDACTED&limit=1&offset=0&order_by=0", "status": 200.0,
+			"request_id": "req-1", "token": "token-1"}},
+		{"/suggest?prefix=bo", "invalid", "", map[string]interface{}{"level": "INFO", "path": "/suggest",
+			"query": "prefix=bo", "status": 401.0, "bytes": 24.0, "token": ""}},
+		{"/?limit=x", "admin", "bad id", map[string]interface{}{"level": "INFO", "query": "limit=x", "status": 400.0,
+			"token": "token-2"}},
+	}
+	for caseNum, item := range cases {
+		out.Reset()
+		w := request(item.target, item.token, item.requestID)
+		var record map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Fatalf("[%d] unexpected log %s: %s", caseNum, out.String(), err)
+		}
+		for key, value := range item.expected {
+			if record[key] != value {
+				t.Errorf("[%d] expected %s %v, got %v", caseNum, key, value, record[key])
+			}
+		}
+		if id := w.Header().Get(requestIDHeader); id != record["request_id"] || (item.requestID != "req-1" && len(id) != 32) {
+			t.Errorf("[%d] expected request id of response %v, got %q", caseNum, record["request_id"], id)
+		}
+		if _, ok := record["latency"]; !ok || strings.Contains(out.String(), "secret") {
+			t.Errorf("[%d] unexpected log %s", caseNum, out.String())
+		}
+	}
+	if _, err := NewAccessLogger(&out, "xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var out bytes.Buffer
+	logger, _ := NewAccessLogger(&out, AccessLogText)
+	delay := time.Duration(0)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/panic":
+			defer recoverInternalError(w)
+			panic("failed")
+		}
+	})
+	handler := AccessLog(next, AccessLogConfig{Logger: logger, SampleSuccess: 3, SlowThreshold: 20 * time.Millisecond})
+	for _, path := range []string{"/", "/", "/missing", "/", "/", "/panic"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	delay = 30 * time.Millisecond
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)) // not sampled, but slow
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"level=INFO msg=request method=GET path=/ query=\"\" status=200 bytes=0",
+		"status=404", "level=INFO msg=request method=GET path=/ query=\"\" status=200", "level=ERROR", "level=WARN"}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d records, got %s", len(expected), out.String())
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, expected[i]) {
+			t.Errorf("[%d] expected %s in %s", i, expected[i], line)
+		}
+	}
+	if !strings.HasSuffix(lines[4], "slow=true") {
+		t.Errorf("expected slow request, got %s", lines[4])
+	}
+	if AccessLog(next, AccessLogConfig{}) == nil {
+		t.Errorf("expected handler without logger")
+	}
+}
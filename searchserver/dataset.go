@@ -0,0 +1,170 @@
+package searchserver
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// Users is the document of xml dataset.
+type Users struct {
+	XMLName xml.Name    `xml:"root"`
+	Members []UserEntry `xml:"row"`
+}
+
+// UserEntry is a record of dataset, fields are named and ordered as elements of dataset.xml in every format.
+type UserEntry struct {
+	Id            int            `xml:"id" json:"id"`
+	Guid          string         `xml:"guid" json:"guid"`
+	IsActive      bool           `xml:"isActive" json:"isActive"`
+	Balance       Amount         `xml:"balance" json:"balance"`
+	Picture       string         `xml:"picture" json:"picture"`
+	Age           int            `xml:"age" json:"age"`
+	EyeColor      string         `xml:"eyeColor" json:"eyeColor"`
+	FirstName     string         `xml:"first_name" json:"first_name"`
+	LastName      string         `xml:"last_name" json:"last_name"`
+	Gender        string         `xml:"gender" json:"gender"`
+	Company       string         `xml:"company" json:"company"`
+	Email         string         `xml:"email" json:"email"`
+	Phone         string         `xml:"phone" json:"phone"`
+	Address       string         `xml:"address" json:"address"`
+	About         string         `xml:"about" json:"about"`
+	Registered    registeredTime `xml:"registered" json:"registered"`
+	FavoriteFruit string         `xml:"favoriteFruit" json:"favoriteFruit"`
+}
+
+func (ue UserEntry) toUser() User {
+	return User{Id: ue.Id, Age: ue.Age, About: ue.About, Name: ue.FirstName + " " + ue.LastName, Gender: ue.Gender}
+}
+
+// Users of dataset along with search structures built on load. Never modified after load,
+// a changed file is loaded into a new dataset ( see Server.Reload ).
+type dataset struct {
+	members  []UserEntry
+	byId     map[int]*UserEntry
+	version  string // hash of file content
+	modTime  time.Time
+	loadedAt time.Time
+	fuzzy    *fuzzyIndex
+	bm25     *bm25Index
+	index    *searchIndex
+	suggest  *suggestIndex
+	spell    *spellIndex
+}
+
+func newDataset(members []UserEntry) *dataset {
+	data := &dataset{members: members, byId: make(map[int]*UserEntry, len(members)), loadedAt: time.Now()}
+	for i := range members {
+		data.byId[members[i].Id] = &members[i]
+	}
+	data.fuzzy = buildFuzzyIndex(members)
+	data.bm25 = buildBM25Index(members)
+	data.index = buildSearchIndex(members, true)
+	data.suggest = buildSuggestIndex(members)
+	data.spell = buildSpellIndex(data.index.users)
+	return data
+}
+
+// Version is a hash of dataset file content.
+func contentVersion(hash hash.Hash) string {
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// RowError reports a record of dataset which can't be loaded.
+type RowError struct {
+	Row  int // 1-based number of record
+	Line int // where record starts, 0 if unknown
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row %d ( line %d ): %s", e.Row, e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Check user before it joins loaded ones: a file written by hand may be parsed but still be wrong.
+func validateEntry(entry *UserEntry, ids map[int]bool) error {
+	switch {
+	case entry.Id < 0:
+		return fmt.Errorf("negative id %d", entry.Id)
+	case ids[entry.Id]:
+		return fmt.Errorf("duplicate id %d", entry.Id)
+	case entry.Age < 0:
+		return fmt.Errorf("negative age %d", entry.Age)
+	case validateAllowedValues(entry.Gender, maleGender, femaleGender) != nil:
+		return fmt.Errorf("invalid gender %q", entry.Gender)
+	}
+	return nil
+}
+
+// rowCollector keeps users decoded one by one, so memory is taken by loaded users only, not by the document.
+// Every format decoder adds rows through it to get the same validation and limit.
+type rowCollector struct {
+	maxRows int // unlimited if 0
+	members []UserEntry
+	ids     map[int]bool
+}
+
+func newRowCollector(maxRows int) *rowCollector {
+	return &rowCollector{maxRows: maxRows, members: []UserEntry{}, ids: make(map[int]bool)}
+}
+
+// Called before decoding the next row: loading stops as soon as limit is exceeded, the rest is not read.
+func (c *rowCollector) reserve() error {
+	if c.maxRows > 0 && len(c.members) == c.maxRows {
+		return fmt.Errorf("more than %d rows", c.maxRows)
+	}
+	return nil
+}
+
+// Error of the next row, line is 0 if unknown.
+func (c *rowCollector) rowError(line int, err error) error {
+	return &RowError{Row: len(c.members) + 1, Line: line, Err: err}
+}
+
+func (c *rowCollector) add(entry *UserEntry, line int) error {
+	if err := validateEntry(entry, c.ids); err != nil {
+		return c.rowError(line, err)
+	}
+	c.ids[entry.Id] = true
+	c.members = append(c.members, *entry)
+	return nil
+}
+
+func (c *rowCollector) result() ([]UserEntry, error) {
+	if len(c.members) < 1 {
+		return nil, errors.New("no users found")
+	}
+	return c.members, nil
+}
+
+// Read users and version of repository content, nil dataset if version is still current ( anything is
+// loaded when current is empty ). Version of repository without contentLoader is read once before users.
+func loadDataset(repository UserRepository, maxRows int, current string) (*dataset, error) {
+	var members []UserEntry
+	var version string
+	var err error
+	if loader, ok := repository.(contentLoader); ok {
+		members, version, err = loader.load(maxRows)
+	} else if version, err = repository.Version(); err == nil && version != current {
+		members, err = repository.Users(maxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if version == current {
+		return nil, nil
+	}
+	data := newDataset(members)
+	data.version = version
+	return data, nil
+}
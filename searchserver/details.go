@@ -0,0 +1,197 @@
+package searchserver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ResponseVersionUser    = 1 // default: users are User records
+	ResponseVersionDetails = 2 // users are UserDetails records
+
+	registeredLayout = "2006-01-02T15:04:05 -07:00" // as written in dataset.xml
+)
+
+// Amount is a fixed-point decimal money amount in cents. Parsed from dataset values like "$2,144.93",
+// serialized as decimal string "2144.93" to keep it exact.
+type Amount int64
+
+func (a Amount) String() string {
+	sign, cents := "", int64(a)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// ParseAmount accepts optional sign, optional "$", thousands separators and up to 2 fractional digits.
+// Separators must split units into groups of 3 digits ( "1,234", not "1,2,34" ).
+func ParseAmount(value string) (Amount, error) {
+	text := strings.TrimSpace(value)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "-"), "$")
+	units, fraction, hasFraction := strings.Cut(text, ".")
+	if groups := strings.Split(units, ","); len(groups) > 1 {
+		for i, group := range groups {
+			if i == 0 && (group == "" || len(group) > 3) || i > 0 && len(group) != 3 {
+				return 0, fmt.Errorf("invalid amount %q", value)
+			}
+		}
+		units = strings.Join(groups, "")
+	}
+	if !isDigits(units) || len(fraction) > 2 || hasFraction && !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+	cents, err := strconv.ParseInt(units+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+// Not empty and ASCII digits only.
+func isDigits(text string) bool {
+	return text != "" && strings.Trim(text, "0123456789") == ""
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	if len(strings.TrimSpace(string(text))) == 0 { // missing in dataset
+		*a = 0
+		return nil
+	}
+	amount, err := ParseAmount(string(text))
+	*a = amount
+	return err
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// JSON datasets may have balance as a number or as a string.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if text, err := strconv.Unquote(string(data)); err == nil {
+		return a.UnmarshalText([]byte(text))
+	}
+	return a.UnmarshalText(data)
+}
+
+// Time of registration as written in dataset.xml: "2017-02-05T06:23:27 -03:00", RFC 3339 is accepted too.
+// Empty value is zero time. Time is not embedded to serialize it in the same layout in every format.
+type registeredTime struct {
+	Time time.Time
+}
+
+func (t *registeredTime) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if value == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	parsed, err := time.Parse(registeredLayout, value)
+	if err != nil {
+		if parsed, err = time.Parse(time.RFC3339, value); err != nil {
+			return errors.New("invalid registered time " + strconv.Quote(value))
+		}
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t registeredTime) MarshalText() ([]byte, error) {
+	if t.Time.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(t.Time.Format(registeredLayout)), nil
+}
+
+// UserDetails is a full dataset record. User fields are embedded, so it is serialized as a superset of User.
+type UserDetails struct {
+	User
+	Guid          string
+	IsActive      bool
+	Balance       Amount
+	Picture       string
+	EyeColor      string
+	Company       string
+	Email         string
+	Phone         string
+	Address       string
+	Registered    time.Time
+	FavoriteFruit string
+}
+
+const (
+	guidField          = "Guid"
+	isActiveField      = "IsActive"
+	balanceField       = "Balance"
+	pictureField       = "Picture"
+	eyeColorField      = "EyeColor"
+	companyField       = "Company"
+	emailField         = "Email"
+	phoneField         = "Phone"
+	addressField       = "Address"
+	registeredField    = "Registered"
+	favoriteFruitField = "FavoriteFruit"
+)
+
+// in order of UserDetails struct
+var detailFields = append(append([]string{}, userFields...), guidField, isActiveField, balanceField, pictureField, eyeColorField,
+	companyField, emailField, phoneField, addressField, registeredField, favoriteFruitField)
+
+func (ue *UserEntry) toUserDetails() UserDetails {
+	return UserDetails{User: ue.toUser(), Guid: ue.Guid, IsActive: ue.IsActive, Balance: ue.Balance, Picture: ue.Picture,
+		EyeColor: ue.EyeColor, Company: ue.Company, Email: ue.Email, Phone: ue.Phone, Address: ue.Address,
+		Registered: ue.Registered.Time, FavoriteFruit: ue.FavoriteFruit}
+}
+
+func detailFieldValue(details *UserDetails, field string) interface{} {
+	switch field {
+	case guidField:
+		return details.Guid
+	case isActiveField:
+		return details.IsActive
+	case balanceField:
+		return details.Balance
+	case pictureField:
+		return details.Picture
+	case eyeColorField:
+		return details.EyeColor
+	case companyField:
+		return details.Company
+	case emailField:
+		return details.Email
+	case phoneField:
+		return details.Phone
+	case addressField:
+		return details.Address
+	case registeredField:
+		return details.Registered
+	case favoriteFruitField:
+		return details.FavoriteFruit
+	default:
+		return userFieldValue(&details.User, field)
+	}
+}
+
+// Serialize page of search result in requested response version.
+func (data *dataset) marshalPage(page []User, searchParams *SearchRequest) ([]byte, error) {
+	if searchParams.ResponseVersion != ResponseVersionDetails {
+		return marshalUsers(page, searchParams.Fields)
+	}
+	details := make([]UserDetails, len(page))
+	for i := range page {
+		details[i] = data.byId[page[i].Id].toUserDetails()
+	}
+	return marshalFields(details, searchParams.Fields, detailFieldValue)
+}
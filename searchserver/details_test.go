@@ -0,0 +1,75 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAmount(t *testing.T) {
+	valid := map[string]Amount{"$2,144.93": 214493, "-$1,000.5": -100050, "3": 300, " 0.07 ": 7, "1,234,567.00": 123456700}
+	for text, expected := range valid {
+		if amount, err := ParseAmount(text); err != nil || amount != expected {
+			t.Errorf("%q: expected %d, got %d ( %v )", text, expected, amount, err)
+		}
+	}
+	for _, text := range []string{"", "$", "1.", "1.234", "$-1", "--1", "1.+5", "abc", "99999999999999999999",
+		"1,2,3.00", ",5", "1,", "1,00", "1,0000", "1234,567", "$,100", "1,234,56", "+1", "1.5,0"} {
+		if amount, err := ParseAmount(text); err == nil {
+			t.Errorf("%q: expected error, got %d", text, amount)
+		}
+	}
+	if text := Amount(-5).String(); text != "-0.05" {
+		t.Errorf("expected -0.05, got %s", text)
+	}
+}
+
+func TestUserEntryDetails(t *testing.T) {
+	boyd := testData.byId[0].toUserDetails()
+	registered := time.Date(2017, 2, 5, 9, 23, 27, 0, time.UTC)
+	if boyd.Name != "Boyd Wolf" || boyd.Balance != 214493 || !boyd.Registered.Equal(registered) || boyd.Company != "HOPELI" {
+		t.Errorf("unexpected details %#v", boyd)
+	}
+	if err := new(registeredTime).UnmarshalText([]byte("2017-02-05 06:23:27")); err == nil {
+		t.Errorf("expected error for time without offset")
+	}
+	// missing optional fields are zero
+	members, err := decodeUsers(strings.NewReader("<root><row><id>1</id><gender>male</gender></row></root>"), FormatXML, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if details := members[0].toUserDetails(); details.Balance != 0 || !details.Registered.IsZero() {
+		t.Errorf("expected zero balance and registered time, got %#v", details)
+	}
+	if _, err := decodeUsers(strings.NewReader("<root><row><id>1</id><gender>male</gender><balance>lots</balance></row></root>"), FormatXML, 0); err == nil {
+		t.Errorf("expected error for invalid balance")
+	}
+}
+
+func TestMarshalPage(t *testing.T) {
+	page := []User{testData.byId[0].toUser()}
+	cases := []struct {
+		params   SearchRequest
+		expected string
+	}{
+		{params: SearchRequest{Fields: []string{idField}}, expected: `[{"Id":0}]`},
+		{params: SearchRequest{Fields: []string{idField, balanceField, registeredField}, ResponseVersion: ResponseVersionDetails},
+			expected: `[{"Id":0,"Balance":"2144.93","Registered":"2017-02-05T06:23:27-03:00"}]`},
+	}
+	for caseNum, item := range cases {
+		response, err := testData.marshalPage(page, &item.params)
+		if err != nil || string(response) != item.expected {
+			t.Errorf("[%d] expected %s, got %s ( %v )", caseNum, item.expected, response, err)
+		}
+	}
+	// without fields, details are a superset of User
+	response, err := testData.marshalPage(page, &SearchRequest{ResponseVersion: ResponseVersionDetails})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var details []map[string]interface{}
+	if err := json.Unmarshal(response, &details); err != nil || len(details) != 1 || len(details[0]) != len(detailFields) {
+		t.Errorf("expected %d fields, got %s ( %v )", len(detailFields), response, err)
+	}
+}
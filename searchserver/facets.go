@@ -0,0 +1,76 @@
+package searchserver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultAgeInterval = 10
+	maxAgeInterval     = 100
+)
+
+func facetError(facet string) error {
+	return &badRequestError{reason: fmt.Sprintf("invalid facet [%s]", facet), detail: facet}
+}
+
+// Parse facets list like "gender,age:5". Interval is allowed for age only.
+func parseFacets(value string) ([]FacetRequest, error) {
+	if value == "" {
+		return nil, nil
+	}
+	facets := []FacetRequest{}
+	for _, facet := range strings.Split(value, ",") {
+		field, interval, hasInterval := strings.Cut(strings.TrimSpace(facet), ":")
+		request := FacetRequest{Field: field}
+		switch {
+		case field == FacetGender && !hasInterval:
+		case field == FacetAge && !hasInterval:
+			request.Interval = defaultAgeInterval
+		case field == FacetAge:
+			width, err := strconv.Atoi(interval)
+			if err != nil || width < 1 || width > maxAgeInterval {
+				return nil, facetError(facet)
+			}
+			request.Interval = width
+		default:
+			return nil, facetError(facet)
+		}
+		facets = append(facets, request)
+	}
+	return facets, nil
+}
+
+// Count users by requested facets. Gender buckets go from the most frequent, age buckets go by age.
+func computeFacets(requests []FacetRequest, users []User) []Facet {
+	facets := make([]Facet, 0, len(requests))
+	for _, request := range requests {
+		facet := Facet{Field: request.Field, Interval: request.Interval, Buckets: []FacetBucket{}}
+		counts := make(map[int]int)
+		byValue := make(map[string]int)
+		for i := range users {
+			if request.Field == FacetGender {
+				byValue[users[i].Gender]++
+			} else {
+				counts[users[i].Age-users[i].Age%request.Interval]++
+			}
+		}
+		for value, count := range byValue {
+			facet.Buckets = append(facet.Buckets, FacetBucket{Value: value, Count: count})
+		}
+		for from, count := range counts {
+			facet.Buckets = append(facet.Buckets, FacetBucket{From: from, To: from + request.Interval, Count: count})
+		}
+		sort.Slice(facet.Buckets, func(i, j int) bool {
+			left, right := facet.Buckets[i], facet.Buckets[j]
+			if left.Count != right.Count && request.Field == FacetGender {
+				return left.Count > right.Count
+			}
+			return left.From < right.From || left.From == right.From && left.Value < right.Value
+		})
+		facets = append(facets, facet)
+	}
+	return facets
+}
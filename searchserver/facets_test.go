@@ -0,0 +1,28 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeFacets(t *testing.T) {
+	users := []User{{Age: 21, Gender: "male"}, {Age: 25, Gender: "female"}, {Age: 29, Gender: "female"}, {Age: 40, Gender: "male"},
+		{Age: 24, Gender: "female"}}
+	requests, err := parseFacets("age:5, gender,age")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []Facet{
+		{Field: FacetAge, Interval: 5, Buckets: []FacetBucket{{From: 20, To: 25, Count: 2}, {From: 25, To: 30, Count: 2}, {From: 40, To: 45, Count: 1}}},
+		{Field: FacetGender, Buckets: []FacetBucket{{Value: "female", Count: 3}, {Value: "male", Count: 2}}},
+		{Field: FacetAge, Interval: 10, Buckets: []FacetBucket{{From: 20, To: 30, Count: 4}, {From: 40, To: 50, Count: 1}}},
+	}
+	if got := computeFacets(requests, users); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected facets %#v, got %#v", expected, got)
+	}
+	for _, invalid := range []string{"eyes", "gender:2", "age:0", "age:x", "age:1000"} {
+		if _, err := parseFacets(invalid); err == nil || err.Error() != "invalid facet ["+invalid+"]" {
+			t.Errorf("expected error for facets %s, got %v", invalid, err)
+		}
+	}
+}
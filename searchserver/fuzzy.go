@@ -0,0 +1,137 @@
+package searchserver
+
+import (
+	"strings"
+)
+
+const maxFuzziness = 2
+
+// Levenshtein distance counted in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// BK-tree over terms: children are keyed by distance to parent,
+// so search visits only subtrees within [d-k, d+k] ( triangle inequality ).
+type bkTree struct {
+	term     string
+	children map[int]*bkTree
+}
+
+func (t *bkTree) add(term string) {
+	for node := t; ; {
+		d := levenshtein(term, node.term)
+		if d == 0 {
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			node.children[d] = &bkTree{term: term, children: map[int]*bkTree{}}
+			return
+		}
+		node = child
+	}
+}
+
+// Find all terms within maxDistance from term. Callback receives term and its distance.
+func (t *bkTree) search(term string, maxDistance int, found func(term string, distance int)) {
+	d := levenshtein(term, t.term)
+	if d <= maxDistance {
+		found(t.term, d)
+	}
+	for childDistance, child := range t.children {
+		if childDistance >= d-maxDistance && childDistance <= d+maxDistance {
+			child.search(term, maxDistance, found)
+		}
+	}
+}
+
+// Name tokens of all users. Tokens are folded: fuzzy search ignores case and diacritics.
+type fuzzyIndex struct {
+	tree     *bkTree
+	postings map[string][]int // token -> ids of users with this token in Name
+}
+
+func tokenizeName(name string) []string {
+	return strings.Fields(foldText(name, true))
+}
+
+func buildFuzzyIndex(users []UserEntry) *fuzzyIndex {
+	index := &fuzzyIndex{postings: make(map[string][]int)}
+	for _, entry := range users {
+		for _, token := range tokenizeName(entry.FirstName + " " + entry.LastName) {
+			if index.tree == nil {
+				index.tree = &bkTree{term: token, children: map[int]*bkTree{}}
+			}
+			index.tree.add(token)
+			index.postings[token] = append(index.postings[token], entry.Id)
+		}
+	}
+	return index
+}
+
+// Match query tokens against Name tokens. Every query token must be matched within maxDistance.
+// Returns distance ( sum over query tokens ) by user id.
+func (index *fuzzyIndex) match(tokens []string, maxDistance int) map[int]int {
+	result := map[int]int(nil)
+	for _, token := range tokens {
+		tokenDistances := make(map[int]int)
+		if index.tree != nil {
+			index.tree.search(token, maxDistance, func(term string, distance int) {
+				for _, id := range index.postings[term] {
+					if known, ok := tokenDistances[id]; !ok || distance < known {
+						tokenDistances[id] = distance
+					}
+				}
+			})
+		}
+		if result == nil {
+			result = tokenDistances
+			continue
+		}
+		for id, distance := range result { // keep users matched by every token
+			if tokenDistance, ok := tokenDistances[id]; ok {
+				result[id] = distance + tokenDistance
+			} else {
+				delete(result, id)
+			}
+		}
+	}
+	return result
+}
+
+type fuzzyQuery struct {
+	tokens      []string
+	maxDistance int
+}
+
+// Fuzzy query on Name. Empty query matches every record.
+type fuzzyNode struct {
+	query     *fuzzyQuery // nil for empty query
+	distances map[int]int
+}
+
+func (n *fuzzyNode) eval(doc *searchDoc) bool {
+	if n.query == nil {
+		return true
+	}
+	_, ok := n.distances[doc.id]
+	return ok
+}
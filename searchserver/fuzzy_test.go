@@ -0,0 +1,39 @@
+package searchserver
+
+import (
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{
+		{a: "", b: "", distance: 0},
+		{a: "meyer", b: "mayer", distance: 1},
+		{a: "kitten", b: "sitting", distance: 3},
+		{a: "wolf", b: "", distance: 4},
+		{a: "jösé", b: "jose", distance: 2},
+	}
+	for caseNum, item := range cases {
+		if d := levenshtein(item.a, item.b); d != item.distance {
+			t.Errorf("[%d] expected distance %d between %s and %s, got %d", caseNum, item.distance, item.a, item.b, d)
+		}
+	}
+}
+
+func TestBKTreeSearch(t *testing.T) {
+	index := buildFuzzyIndex(testData.members)
+	for _, query := range []string{"mayer", "bel", "whitny", "x", "dillard"} {
+		for distance := 0; distance <= maxFuzziness; distance++ {
+			found := map[string]int{}
+			index.tree.search(query, distance, func(term string, d int) { found[term] = d })
+			for term := range index.postings { // BK-tree must find exactly what brute force finds
+				d := levenshtein(query, term)
+				if got, ok := found[term]; (d <= distance) != ok || ok && got != d {
+					t.Errorf("query %s with distance %d: term %s expected distance %d, found %v (%d)", query, distance, term, d, ok, got)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package searchserver
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultHighlightPre  = "<em>"
+	defaultHighlightPost = "</em>"
+	defaultSnippetLength = 160
+	minSnippetLength     = 20
+	maxSnippetLength     = 1000
+	snippetEllipsis      = "…"
+)
+
+// Terms of query which make record match: terms under NOT are skipped.
+func positiveTerms(node queryNode, negated bool, terms []*termNode) []*termNode {
+	switch n := node.(type) {
+	case *termNode:
+		if !negated && n.text != "" {
+			terms = append(terms, n)
+		}
+	case *andNode:
+		terms = positiveTerms(n.right, negated, positiveTerms(n.left, negated, terms))
+	case *orNode:
+		terms = positiveTerms(n.right, negated, positiveTerms(n.left, negated, terms))
+	case *notNode:
+		terms = positiveTerms(n.operand, !negated, terms)
+	}
+	return terms
+}
+
+// Find occurrences of terms in value. Terms are normalized already, so value is normalized the same way
+// and found ranges are mapped back to original value.
+func locateTerms(terms []*termNode, field string, value string, matchMode string) [][2]int {
+	normalized, starts, ends := value, []int(nil), []int(nil)
+	if matchMode == MatchModeCaseInsensitive || matchMode == MatchModeFolded {
+		normalized, starts, ends = foldTextWithOffsets(value, matchMode == MatchModeFolded)
+	}
+	ranges := [][2]int{}
+	for _, term := range terms {
+		if term.field != "" && term.field != field {
+			continue
+		}
+		for offset := 0; offset < len(normalized); {
+			i := strings.Index(normalized[offset:], term.text)
+			if i < 0 {
+				break
+			}
+			start, end := offset+i, offset+i+len(term.text)
+			if starts != nil {
+				ranges = append(ranges, [2]int{starts[start], ends[end-1]})
+			} else {
+				ranges = append(ranges, [2]int{start, end})
+			}
+			offset = end
+		}
+	}
+	return ranges
+}
+
+// Name words within fuzziness from any of query words.
+func locateFuzzy(query *fuzzyQuery, value string) [][2]int {
+	ranges := [][2]int{}
+	for start := 0; start < len(value); {
+		wordStart := strings.IndexFunc(value[start:], func(r rune) bool { return !unicode.IsSpace(r) })
+		if wordStart < 0 {
+			break
+		}
+		wordStart += start
+		wordEnd := strings.IndexFunc(value[wordStart:], unicode.IsSpace)
+		if wordEnd < 0 {
+			wordEnd = len(value)
+		} else {
+			wordEnd += wordStart
+		}
+		word := foldText(value[wordStart:wordEnd], true)
+		for _, token := range query.tokens {
+			if levenshtein(token, word) <= query.maxDistance {
+				ranges = append(ranges, [2]int{wordStart, wordEnd})
+				break
+			}
+		}
+		start = wordEnd
+	}
+	return ranges
+}
+
+// Sort ranges and merge overlapping ones.
+func mergeRanges(ranges [][2]int) [][2]int {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			last[1] = max(last[1], r[1])
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// Find match ranges of query in value of field ( Name or About ).
+func locateMatches(query queryNode, field string, value string, matchMode string) [][2]int {
+	switch q := query.(type) {
+	case *regexNode:
+		if field != queryFieldName {
+			return nil
+		}
+		ranges := [][2]int{}
+		for _, r := range q.re.FindAllStringIndex(value, -1) {
+			if r[0] < r[1] {
+				ranges = append(ranges, [2]int{r[0], r[1]})
+			}
+		}
+		return mergeRanges(ranges)
+	case *fuzzyNode:
+		if q.query == nil || field != queryFieldName {
+			return nil
+		}
+		return mergeRanges(locateFuzzy(q.query, value))
+	default:
+		return mergeRanges(locateTerms(positiveTerms(query, false, nil), field, value, matchMode))
+	}
+}
+
+// Part of text around first match, not longer than length characters ( not counting markers ).
+// Window is aligned to words, all matches inside it are wrapped with markers.
+func buildSnippet(text string, ranges [][2]int, options *HighlightOptions) string {
+	if len(ranges) == 0 {
+		return ""
+	}
+	first := ranges[0]
+	textEnd := max(len(strings.TrimRightFunc(text, unicode.IsSpace)), first[1])
+	start, end := first[0], first[1]
+	for budget := options.SnippetLength - utf8.RuneCountInString(text[start:end]); budget > 0 && (start > 0 || end < textEnd); {
+		if start > 0 {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+			budget--
+		}
+		if budget > 0 && end < textEnd {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+			budget--
+		}
+	}
+	if start > 0 { // don't start in the middle of a word
+		if i := strings.IndexFunc(text[start:first[0]], unicode.IsSpace); i >= 0 {
+			start += i
+		}
+	}
+	if end < textEnd {
+		if i := strings.LastIndexFunc(text[first[1]:end], unicode.IsSpace); i >= 0 {
+			end = first[1] + i
+		}
+	}
+	for start < first[0] && unicode.IsSpace(rune(text[start])) {
+		start++
+	}
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString(snippetEllipsis)
+	}
+	pos := start
+	for _, r := range ranges {
+		from, to := max(r[0], start), min(r[1], end)
+		if from >= to {
+			continue
+		}
+		snippet.WriteString(text[pos:from])
+		snippet.WriteString(options.PreTag)
+		snippet.WriteString(text[from:to])
+		snippet.WriteString(options.PostTag)
+		pos = to
+	}
+	snippet.WriteString(strings.TrimRightFunc(text[pos:end], unicode.IsSpace))
+	if end < textEnd {
+		snippet.WriteString(snippetEllipsis)
+	}
+	return snippet.String()
+}
+
+func highlightUser(user *User, query queryNode, searchParams *SearchRequest) Highlight {
+	matchMode := searchParams.MatchMode
+	if searchParams.QueryMode == QueryModeRegex {
+		matchMode = MatchModeExact
+	}
+	highlight := Highlight{
+		Name:  locateMatches(query, queryFieldName, user.Name, matchMode),
+		About: locateMatches(query, queryFieldAbout, user.About, matchMode),
+	}
+	highlight.Snippet = buildSnippet(user.About, highlight.About, searchParams.Highlight)
+	return highlight
+}
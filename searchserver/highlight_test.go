@@ -0,0 +1,48 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLocateMatches(t *testing.T) {
+	cases := []struct {
+		query     string
+		matchMode string
+		value     string
+		expected  [][2]int
+	}{
+		{query: `ex`, value: "ex commodo ex", expected: [][2]int{{0, 2}, {11, 13}}},
+		{query: `"o e" OR commodo`, value: "ex commodo ex", expected: [][2]int{{3, 12}}},
+		{query: `ex NOT commodo`, value: "ex commodo ex", expected: [][2]int{{0, 2}, {11, 13}}},
+		{query: `name:ex about:commodo`, value: "ex commodo ex", expected: [][2]int{{3, 10}}},
+		{query: `strasse`, matchMode: MatchModeFolded, value: "Große Straße", expected: [][2]int{{7, 14}}},
+		{query: ``, value: "ex commodo ex", expected: nil},
+	}
+	for caseNum, item := range cases {
+		query, _ := parseQuery(item.query)
+		mapTerms(query, normalizer(item.matchMode))
+		if got := locateMatches(query, queryFieldAbout, item.value, item.matchMode); !reflect.DeepEqual(got, item.expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, item.expected, got)
+		}
+	}
+}
+
+func TestBuildSnippet(t *testing.T) {
+	text := "Sit commodo consectetur minim amet ex. Elit aute mollit fugiat labore sint ipsum dolor.\n"
+	options := &HighlightOptions{PreTag: "[", PostTag: "]", SnippetLength: 30}
+	cases := []struct {
+		ranges   [][2]int
+		expected string
+	}{
+		{ranges: [][2]int{{0, 3}}, expected: "[Sit] commodo consectetur minim…"},
+		{ranges: [][2]int{{30, 34}, {35, 37}}, expected: "…minim [amet] [ex]. Elit…"},
+		{ranges: [][2]int{{81, 86}}, expected: "…labore sint ipsum [dolor]."},
+		{ranges: nil, expected: ""},
+	}
+	for caseNum, item := range cases {
+		if got := buildSnippet(text, item.ranges, options); got != item.expected {
+			t.Errorf("[%d] expected %q, got %q", caseNum, item.expected, got)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package searchserver
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const ngramSize = 3
+
+// Inverted index of one field. Tokens are words of folded text ( see tokenizeWords ),
+// postings are sorted positions of users in searchIndex.users.
+type fieldIndex struct {
+	postings map[string][]int32
+	vocab    []string
+	ngrams   map[string][]int32 // ngram -> positions of tokens in vocab containing it, nil if disabled
+}
+
+func buildFieldIndex(values []string, withNgrams bool) *fieldIndex {
+	index := &fieldIndex{postings: make(map[string][]int32)}
+	for i, value := range values {
+		for _, token := range tokenizeWords(value) {
+			postings := index.postings[token]
+			if len(postings) == 0 || postings[len(postings)-1] != int32(i) {
+				index.postings[token] = append(postings, int32(i))
+			}
+		}
+	}
+	index.vocab = make([]string, 0, len(index.postings))
+	for token := range index.postings {
+		index.vocab = append(index.vocab, token)
+	}
+	sort.Strings(index.vocab)
+	if !withNgrams {
+		return index
+	}
+	index.ngrams = make(map[string][]int32)
+	for i, token := range index.vocab {
+		for _, gram := range tokenNgrams(token) {
+			tokens := index.ngrams[gram]
+			if len(tokens) == 0 || tokens[len(tokens)-1] != int32(i) {
+				index.ngrams[gram] = append(tokens, int32(i))
+			}
+		}
+	}
+	return index
+}
+
+func tokenNgrams(token string) []string {
+	runes := []rune(token)
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+ngramSize <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+ngramSize]))
+	}
+	return grams
+}
+
+// Tokens of vocab which may contain word. Ngrams narrow the scan when word is long enough.
+func (index *fieldIndex) vocabCandidates(word string) []string {
+	grams := tokenNgrams(word)
+	if index.ngrams == nil || len(grams) == 0 {
+		return index.vocab
+	}
+	positions := index.ngrams[grams[0]]
+	for _, gram := range grams[1:] {
+		positions = intersectPostings(positions, index.ngrams[gram])
+	}
+	tokens := make([]string, len(positions))
+	for i, position := range positions {
+		tokens[i] = index.vocab[position]
+	}
+	return tokens
+}
+
+// Positions of users which may contain substring. Substring is split into words:
+// a word cut by substring start may be the end of a token, a word cut by substring end may be the beginning
+// of a token, words in the middle must be tokens. Returns all=true when words don't narrow anything.
+func (index *fieldIndex) candidates(substring string) (positions []int32, all bool) {
+	folded := foldText(substring, true)
+	isSeparator := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+	all = true
+	for start := 0; start < len(folded); {
+		wordStart := strings.IndexFunc(folded[start:], func(r rune) bool { return !isSeparator(r) })
+		if wordStart < 0 {
+			break
+		}
+		wordStart += start
+		wordEnd := strings.IndexFunc(folded[wordStart:], isSeparator)
+		if wordEnd < 0 {
+			wordEnd = len(folded)
+		} else {
+			wordEnd += wordStart
+		}
+		word, openLeft, openRight := folded[wordStart:wordEnd], wordStart == 0, wordEnd == len(folded)
+		var wordPositions []int32
+		for _, token := range index.vocabCandidates(word) {
+			matched := token == word
+			switch {
+			case openLeft && openRight:
+				matched = strings.Contains(token, word)
+			case openLeft:
+				matched = strings.HasSuffix(token, word)
+			case openRight:
+				matched = strings.HasPrefix(token, word)
+			}
+			if matched {
+				wordPositions = unionPostings(wordPositions, index.postings[token])
+			}
+		}
+		if all {
+			positions, all = wordPositions, false
+		} else {
+			positions = intersectPostings(positions, wordPositions)
+		}
+		start = wordEnd
+	}
+	return positions, all
+}
+
+func intersectPostings(a, b []int32) []int32 {
+	result := make([]int32, 0, min(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func unionPostings(a, b []int32) []int32 {
+	result := make([]int32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// Users converted once on load along with normalized text for every match mode and inverted index.
+type searchIndex struct {
+	users []User
+	docs  map[string][]searchDoc // match mode -> docs aligned with users
+	name  *fieldIndex
+	about *fieldIndex
+}
+
+func buildSearchIndex(entries []UserEntry, withNgrams bool) *searchIndex {
+	index := &searchIndex{users: make([]User, len(entries)), docs: make(map[string][]searchDoc)}
+	names, abouts := make([]string, len(entries)), make([]string, len(entries))
+	for i := range entries {
+		index.users[i] = entries[i].toUser()
+		names[i], abouts[i] = index.users[i].Name, index.users[i].About
+	}
+	for _, matchMode := range []string{MatchModeExact, MatchModeCaseInsensitive, MatchModeFolded} {
+		normalize, docs := normalizer(matchMode), make([]searchDoc, len(entries))
+		for i := range index.users {
+			docs[i] = searchDoc{id: index.users[i].Id, name: normalize(names[i]), about: normalize(abouts[i])}
+		}
+		index.docs[matchMode] = docs
+	}
+	index.docs[""] = index.docs[MatchModeExact]
+	index.name, index.about = buildFieldIndex(names, withNgrams), buildFieldIndex(abouts, withNgrams)
+	return index
+}
+
+// Positions of users which may match query, verified with query.eval afterwards.
+// Returns all=true when index can't narrow the search ( regex, fuzzy, negation ).
+func (index *searchIndex) candidates(query queryNode) (positions []int32, all bool) {
+	switch n := query.(type) {
+	case *termNode:
+		switch n.field {
+		case queryFieldName:
+			return index.name.candidates(n.text)
+		case queryFieldAbout:
+			return index.about.candidates(n.text)
+		}
+		name, allNames := index.name.candidates(n.text)
+		about, allAbouts := index.about.candidates(n.text)
+		if allNames || allAbouts {
+			return nil, true
+		}
+		return unionPostings(name, about), false
+	case *andNode:
+		left, allLeft := index.candidates(n.left)
+		right, allRight := index.candidates(n.right)
+		switch {
+		case allLeft:
+			return right, allRight
+		case allRight:
+			return left, false
+		}
+		return intersectPostings(left, right), false
+	case *orNode:
+		left, allLeft := index.candidates(n.left)
+		right, allRight := index.candidates(n.right)
+		if allLeft || allRight {
+			return nil, true
+		}
+		return unionPostings(left, right), false
+	default:
+		return nil, true
+	}
+}
+
+// Users matching query and filters. Linear scan checks every user, which is kept for comparison in tests.
+func (index *searchIndex) find(query queryNode, searchParams *SearchRequest, linearScan bool) []User {
+	docs := index.docs[searchParams.MatchMode]
+	if searchParams.QueryMode == QueryModeRegex { // regex handles case itself, (?i) is added on compile
+		docs = index.docs[MatchModeExact]
+	}
+	positions, all := index.candidates(query)
+	if linearScan {
+		all = true
+	}
+	count := len(positions)
+	if all {
+		count = len(index.users)
+	}
+	result := make([]User, 0, min(count, 64))
+	for i := 0; i < count; i++ {
+		position := i
+		if !all {
+			position = int(positions[i])
+		}
+		if matches(&index.users[position], &docs[position], query, &searchParams.Filters) {
+			result = append(result, index.users[position])
+		}
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package searchserver
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	queries := []string{"", " ", "commodo e", "o e", "ex.", "e. E", "Boyd Wolf", "yd Wo", "a", "BOYD", "Dillard", "um.\n",
+		"irure dolor", "Lorem", "lorem", "Strauß", "ex", "NOT commodo", "name:oyd OR about:ullamco", "(ex OR es) AND NOT \"nisi\"",
+		"\"commodo ex\" ex", "ut -", "  a  b  "}
+	for _, withNgrams := range []bool{true, false} {
+		index := buildSearchIndex(testData.members, withNgrams)
+		for _, queryMode := range []string{QueryModeSubstring, QueryModeBoolean} {
+			for _, matchMode := range []string{MatchModeExact, MatchModeCaseInsensitive, MatchModeFolded} {
+				for _, q := range queries {
+					searchParams := &SearchRequest{Query: q, QueryMode: queryMode, MatchMode: matchMode}
+					query, err := testData.compileQuery(searchParams, defaultRegexMatchTimeout)
+					if err != nil {
+						continue // not a valid boolean query
+					}
+					indexed, scanned := index.find(query, searchParams, false), index.find(query, searchParams, true)
+					if !reflect.DeepEqual(indexed, scanned) {
+						t.Errorf("ngrams %v, %s, %s, %q: indexed search found %d users, linear scan %d",
+							withNgrams, queryMode, matchMode, q, len(indexed), len(scanned))
+					}
+				}
+			}
+		}
+	}
+}
+
+// Dataset of n users: rows of dataset.xml with unique ids and generated last names.
+func generateUsers(n int) []UserEntry {
+	syllables := []string{"ba", "ko", "ri", "mu", "sel", "dan", "tor", "vi", "gle", "nor", "pa", "xu"}
+	users := make([]UserEntry, n)
+	for i := range users {
+		users[i] = testData.members[i%len(testData.members)]
+		users[i].Id = i
+		var lastName strings.Builder
+		for x := i*7919 + 1; x > 0; x /= len(syllables) {
+			lastName.WriteString(syllables[x%len(syllables)])
+		}
+		users[i].LastName = strings.ToUpper(lastName.String()[:1]) + lastName.String()[1:] + strconv.Itoa(i%97)
+	}
+	return users
+}
+
+func benchmarkFind(b *testing.B, linearScan bool) {
+	index := buildSearchIndex(generateUsers(100000), true)
+	for _, q := range []string{"Boyd Wolf", "kosel", "commodo ex", "Lorem"} {
+		searchParams := &SearchRequest{Query: q}
+		query, _ := testData.compileQuery(searchParams, defaultRegexMatchTimeout)
+		b.Run(fmt.Sprintf("query=%s", q), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				index.find(query, searchParams, linearScan)
+			}
+		})
+	}
+}
+
+func BenchmarkSearchLinearScan100k(b *testing.B) { benchmarkFind(b, true) }
+
+func BenchmarkSearchIndexed100k(b *testing.B) { benchmarkFind(b, false) }
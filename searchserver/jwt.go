@@ -0,0 +1,277 @@
+package searchserver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256" // HMAC SHA-256 with "oct" key
+	AlgEdDSA = "EdDSA" // Ed25519 with "OKP" key
+
+	defaultClockSkew = time.Minute
+	minHMACKeySize   = 32 // RFC 7518: key of the same size as hash output or larger
+)
+
+var (
+	JWTMalformedError    error = errors.New("malformed token")
+	JWTAlgorithmError    error = errors.New("unsupported algorithm")
+	JWTUnknownKeyError   error = errors.New("unknown key")
+	JWTSignatureError    error = errors.New("invalid signature")
+	JWTExpiredError      error = errors.New("token expired")
+	JWTNotYetValidError  error = errors.New("token not valid yet")
+	JWTIssuerError       error = errors.New("invalid issuer")
+	JWTAudienceError     error = errors.New("invalid audience")
+	JWTMissingClaimError error = errors.New("missing exp or sub claim")
+)
+
+type JWTConfig struct {
+	JWKSPath  string        // JSON Web Key Set with HS256 ( "oct" ) and Ed25519 ( "OKP" ) keys, other keys are skipped
+	Issuer    string        // expected iss, not checked if empty
+	Audience  string        // expected in aud, not checked if empty
+	ClockSkew time.Duration // tolerance of exp and nbf, 1 minute if 0
+}
+
+// JWTVerifier checks signed tokens of Authorization: Bearer header. Keys are read again by Reload when JWKS
+// file changes ( see Server.Watch ).
+type JWTVerifier struct {
+	config JWTConfig
+	keys   atomic.Pointer[[]verifyKey]
+
+	reloadMu    sync.Mutex
+	seenModTime time.Time
+	seenSize    int64
+}
+
+type verifyKey struct {
+	kid, alg string
+	secret   []byte            // AlgHS256
+	public   ed25519.PublicKey // AlgEdDSA
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"` // secret of "oct"
+	X   string `json:"x"` // public key of "OKP"
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Claims used by server, scopes are taken from space-separated "scope" ( RFC 8693 ) and "scp" array.
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	Expires   *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	Scope     string      `json:"scope"`
+	Scp       []string    `json:"scp"`
+}
+
+// aud is a string or an array of strings.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if config.ClockSkew == 0 {
+		config.ClockSkew = defaultClockSkew
+	}
+	verifier := &JWTVerifier{config: config}
+	if _, err := verifier.Reload(); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+// Reload reads JWKS file if its modification time or size has changed. Broken file is reported and keys
+// are kept.
+func (verifier *JWTVerifier) Reload() (bool, error) {
+	verifier.reloadMu.Lock()
+	defer verifier.reloadMu.Unlock()
+	info, err := os.Stat(verifier.config.JWKSPath)
+	if err != nil {
+		return false, fmt.Errorf("error reading JWKS file [%s]: %w", verifier.config.JWKSPath, err)
+	}
+	if info.ModTime().Equal(verifier.seenModTime) && info.Size() == verifier.seenSize {
+		return false, nil
+	}
+	content, err := os.ReadFile(verifier.config.JWKSPath)
+	if err != nil {
+		return false, fmt.Errorf("error reading JWKS file [%s]: %w", verifier.config.JWKSPath, err)
+	}
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return false, fmt.Errorf("error parsing JWKS file [%s]: %w", verifier.config.JWKSPath, err)
+	}
+	verifier.keys.Store(&keys)
+	verifier.seenModTime, verifier.seenSize = info.ModTime(), info.Size()
+	return true, nil
+}
+
+func parseJWKS(content []byte) ([]verifyKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+	keys := []verifyKey{}
+	for i, jwk := range set.Keys {
+		key := verifyKey{kid: jwk.Kid}
+		var err error
+		switch {
+		case jwk.Kty == "oct" && (jwk.Alg == "" || jwk.Alg == AlgHS256):
+			key.alg = AlgHS256
+			if key.secret, err = base64.RawURLEncoding.DecodeString(jwk.K); err == nil && len(key.secret) < minHMACKeySize {
+				err = fmt.Errorf("secret shorter than %d bytes", minHMACKeySize)
+			}
+		case jwk.Kty == "OKP" && jwk.Crv == "Ed25519" && (jwk.Alg == "" || jwk.Alg == AlgEdDSA):
+			key.alg = AlgEdDSA
+			var public []byte
+			if public, err = base64.RawURLEncoding.DecodeString(jwk.X); err == nil && len(public) != ed25519.PublicKeySize {
+				err = fmt.Errorf("public key of %d bytes", len(public))
+			}
+			key.public = public
+		default:
+			continue // other key types and algorithms are not accepted
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d ( kid %q ): %w", i+1, jwk.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no HS256 or Ed25519 keys")
+	}
+	return keys, nil
+}
+
+// Verify checks signature and claims of token at now. Token name is "jwt:" and subject, scopes are known
+// scopes of claims.
+func (verifier *JWTVerifier) Verify(raw string, now time.Time) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, JWTMalformedError
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != AlgHS256 && header.Alg != AlgEdDSA { // "none" and everything else
+		return nil, JWTAlgorithmError
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, JWTMalformedError
+	}
+	if err := verifier.verifySignature(&header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := verifier.checkClaims(&claims, now); err != nil {
+		return nil, err
+	}
+	token := &Token{Name: "jwt:" + claims.Subject, Scopes: []string{}}
+	for _, scope := range append(strings.Fields(claims.Scope), claims.Scp...) {
+		if validateAllowedValues(scope, ScopeSearch, ScopeReadPII, ScopeWrite, ScopeAdmin) == nil && !token.hasScope(scope) {
+			token.Scopes = append(token.Scopes, scope)
+		}
+	}
+	return token, nil
+}
+
+func decodeJWTPart(part string, target interface{}) error {
+	content, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return JWTMalformedError
+	}
+	if err := json.NewDecoder(bytes.NewReader(content)).Decode(target); err != nil {
+		return JWTMalformedError
+	}
+	return nil
+}
+
+// Key is chosen by kid, or every key of the algorithm is tried when token has no kid. Key of another
+// algorithm is never used: HS256 token can't be checked with a public key as a secret.
+func (verifier *JWTVerifier) verifySignature(header *jwtHeader, input, signature []byte) error {
+	keys := *verifier.keys.Load()
+	known := false
+	for _, key := range keys {
+		if header.Kid != "" && key.kid != header.Kid {
+			continue
+		}
+		known = true
+		if key.alg != header.Alg {
+			continue
+		}
+		switch key.alg {
+		case AlgHS256:
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write(input)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return nil
+			}
+		case AlgEdDSA:
+			if ed25519.Verify(key.public, input, signature) {
+				return nil
+			}
+		}
+	}
+	if !known {
+		return JWTUnknownKeyError
+	}
+	return JWTSignatureError
+}
+
+func (verifier *JWTVerifier) checkClaims(claims *jwtClaims, now time.Time) error {
+	skew := verifier.config.ClockSkew
+	switch {
+	case claims.Expires == nil || claims.Subject == "":
+		return JWTMissingClaimError
+	case !now.Before(numericDate(*claims.Expires).Add(skew)):
+		return JWTExpiredError
+	case claims.NotBefore != nil && now.Add(skew).Before(numericDate(*claims.NotBefore)):
+		return JWTNotYetValidError
+	case verifier.config.Issuer != "" && claims.Issuer != verifier.config.Issuer:
+		return JWTIssuerError
+	case verifier.config.Audience != "" && !slices.Contains(claims.Audience, verifier.config.Audience):
+		return JWTAudienceError
+	}
+	return nil
+}
+
+// Seconds since epoch, possibly fractional.
+func numericDate(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9))
+}
@@ -0,0 +1,270 @@
+package searchserver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret         = []byte("0123456789abcdef0123456789abcdef")
+	testPublic, testED = mustEd25519Key()
+)
+
+func mustEd25519Key() (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		panic(err)
+	}
+	return public, private
+}
+
+// Sign claims with HS256 secret ( []byte ) or Ed25519 private key.
+func mintJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(input))
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	content, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testJWKS() []map[string]string {
+	return []map[string]string{
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": base64.RawURLEncoding.EncodeToString(testSecret)},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(testPublic)},
+		{"kty": "RSA", "kid": "rsa", "n": "AQAB", "e": "AQAB"}, // skipped
+	}
+}
+
+func newTestJWTVerifier(t *testing.T) (*JWTVerifier, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, testJWKS()...)
+	verifier, err := NewJWTVerifier(JWTConfig{JWKSPath: path, Issuer: "https://issuer.example", Audience: "searchserver",
+		ClockSkew: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return verifier, path
+}
+
+func TestJWTVerify(t *testing.T) {
+	verifier, _ := newTestJWTVerifier(t)
+	now := time.Unix(1_800_000_000, 0)
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"sub": "ci", "iss": "https://issuer.example", "aud": []string{"other", "searchserver"},
+			"exp": now.Unix() + 60, "nbf": now.Unix() - 60, "scope": "search read-pii openid", "scp": []string{"write", "search"}}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	for _, token := range []string{mintJWT(t, AlgHS256, "hs", testSecret, claims(nil)), mintJWT(t, AlgEdDSA, "ed", testED, claims(nil)),
+		mintJWT(t, AlgEdDSA, "", testED, claims(nil))} {
+		verified, err := verifier.Verify(token, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if expected := (&Token{Name: "jwt:ci", Scopes: []string{ScopeSearch, ScopeReadPII, ScopeWrite}}); !reflect.DeepEqual(verified, expected) {
+			t.Errorf("expected %#v, got %#v", expected, verified)
+		}
+	}
+	accepted := []map[string]interface{}{
+		claims(map[string]interface{}{"exp": now.Unix() - 29}), // within clock skew
+		claims(map[string]interface{}{"nbf": now.Unix() + 29}),
+		claims(map[string]interface{}{"nbf": nil, "scope": nil, "scp": nil, "aud": "searchserver"}),
+		claims(map[string]interface{}{"exp": float64(now.Unix()) - 29.5}),
+	}
+	for caseNum, claims := range accepted {
+		if _, err := verifier.Verify(mintJWT(t, AlgHS256, "hs", testSecret, claims), now); err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+		}
+	}
+
+	otherPublic, otherED := mustEd25519Key()
+	rejected := []struct {
+		token string
+		err   error
+	}{
+		{mintJWT(t, AlgHS256, "hs", testSecret, claims(map[string]interface{}{"exp": now.Unix() - 30})), JWTExpiredError},
+		{mintJWT(t, AlgHS256, "hs", testSecret, claims(map[string]interface{}{"nbf": now.Unix() + 31})), JWTNotYetValidError},
+		{mintJWT(t, AlgHS256, "hs", testSecret, claims(map[string]interface{}{"exp": nil})), JWTMissingClaimError},
+		{mintJWT(t, AlgHS256, "hs", testSecret, claims(map[string]interface{}{"sub": nil})), JWTMissingClaimError},
+		{mintJWT(t, AlgHS256, "hs", testSecret, claims(map[string]interface{}{"iss": "https://evil.example"})), JWTIssuerError},
+		{mintJWT(t, AlgHS256, "hs", testSecret, claims(map[string]interface{}{"aud": "other"})), JWTAudienceError},
+		{mintJWT(t, AlgHS256, "hs", []byte("another secret of 32 bytes......"), claims(nil)), JWTSignatureError},
+		{mintJWT(t, AlgEdDSA, "ed", otherED, claims(nil)), JWTSignatureError},
+		{mintJWT(t, AlgEdDSA, "", otherED, claims(nil)), JWTSignatureError},
+		{mintJWT(t, AlgHS256, "unknown", testSecret, claims(nil)), JWTUnknownKeyError},
+		// HS256 with public key of Ed25519 as a secret
+		{mintJWT(t, AlgHS256, "ed", []byte(otherPublic), claims(nil)), JWTSignatureError},
+		{mintJWT(t, AlgHS256, "ed", []byte(testPublic), claims(nil)), JWTSignatureError},
+		{mintJWT(t, "none", "", nil, claims(nil)), JWTAlgorithmError},
+		{mintJWT(t, "RS256", "rsa", testSecret, claims(nil)), JWTAlgorithmError},
+		{"a.b", JWTMalformedError},
+		{"!.b.c", JWTMalformedError},
+		{base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + ".!.c", JWTMalformedError},
+		{strings.TrimSuffix(mintJWT(t, AlgHS256, "hs", testSecret, claims(nil)), "A") + "!", JWTMalformedError},
+	}
+	for caseNum, item := range rejected {
+		if _, err := verifier.Verify(item.token, now); err != item.err {
+			t.Errorf("[%d] expected %v, got %v", caseNum, item.err, err)
+		}
+	}
+	// signed claims which are not JSON
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"hs"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte("claims"))
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(input))
+	if _, err := verifier.Verify(input+"."+base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), now); err != JWTMalformedError {
+		t.Errorf("expected %v, got %v", JWTMalformedError, err)
+	}
+}
+
+func TestJWKSReload(t *testing.T) {
+	verifier, path := newTestJWTVerifier(t)
+	now := time.Now()
+	claims := map[string]interface{}{"sub": "ci", "iss": "https://issuer.example", "aud": "searchserver", "exp": now.Unix() + 60}
+	old := mintJWT(t, AlgHS256, "hs", testSecret, claims)
+	if changed, err := verifier.Reload(); changed || err != nil {
+		t.Errorf("expected unchanged file not to be read, got %v ( %v )", changed, err)
+	}
+
+	// rotated key
+	secret := []byte("rotated secret of 32 bytes......")
+	writeJWKS(t, path, map[string]string{"kty": "oct", "kid": "hs2", "k": base64.RawURLEncoding.EncodeToString(secret)})
+	if changed, err := verifier.Reload(); !changed || err != nil {
+		t.Fatalf("expected keys to be reloaded, got %v ( %v )", changed, err)
+	}
+	if _, err := verifier.Verify(old, now); err != JWTUnknownKeyError {
+		t.Errorf("expected old key to be unknown, got %v", err)
+	}
+	rotated := mintJWT(t, AlgHS256, "hs2", secret, claims)
+	if _, err := verifier.Verify(rotated, now); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// broken files keep keys
+	for content, expected := range map[string]string{
+		`{"keys": [`: "unexpected end of JSON input",
+		`{"keys": [{"kty": "oct", "k": "c2hvcnQ"}]}`:                             "secret shorter than 32 bytes",
+		`{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "c2hvcnQ"}]}`:           "public key of 5 bytes",
+		`{"keys": [{"kty": "oct", "k": "!"}]}`:                                   "illegal base64",
+		`{"keys": [{"kty": "OKP", "crv": "X25519", "x": "c2hvcnQ"}]}`:            "no HS256 or Ed25519 keys",
+		`{"keys": [{"kty": "oct", "alg": "HS512", "k": "c2hvcnQ"}], "other": 1}`: "no HS256 or Ed25519 keys",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Reload(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error %s, got %v", content, expected, err)
+		}
+		if _, err := verifier.Verify(rotated, now); err != nil {
+			t.Errorf("%s: expected keys to be kept, got %v", content, err)
+		}
+	}
+	os.Remove(path)
+	if _, err := verifier.Reload(); err == nil || !strings.HasPrefix(err.Error(), "error reading JWKS file") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+	if _, err := NewJWTVerifier(JWTConfig{JWKSPath: path}); err == nil {
+		t.Errorf("expected missing file error")
+	}
+}
+
+// Bearer token is checked instead of AccessToken, its scopes apply as scopes of stored tokens.
+func TestBearerAuthorization(t *testing.T) {
+	verifier, path := newTestJWTVerifier(t)
+	var logs bytes.Buffer
+	server := newUsersTestServer(t, Config{JWT: verifier})
+	server.config.Logger = log.New(&logs, "", 0)
+	claims := map[string]interface{}{"sub": "ci", "iss": "https://issuer.example", "aud": "searchserver",
+		"exp": time.Now().Unix() + 60, "scope": "search"}
+	token := mintJWT(t, AlgEdDSA, "ed", testED, claims)
+	cases := []struct {
+		path, authorization string
+		status              int
+	}{
+		{"/?limit=1&offset=0&order_by=0", "Bearer " + token, http.StatusOK},
+		{"/?limit=1&offset=0&order_by=0", "Bearer " + token + "x", http.StatusUnauthorized},
+		{"/?limit=1&offset=0&order_by=0", "Basic " + token, http.StatusUnauthorized},
+		{"/?limit=1&offset=0&order_by=0&response_version=2", "Bearer " + token, http.StatusForbidden},
+		{"/admin/dataset", "Bearer " + token, http.StatusForbidden},
+	}
+	for caseNum, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, item.path, nil)
+		r.Header.Set("Authorization", item.authorization)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != item.status {
+			t.Errorf("[%d] expected %d, got %d %s", caseNum, item.status, w.Code, w.Body)
+		}
+	}
+	// AccessToken keeps working, bearer token is not accepted without JWT config
+	if w := userRequest(server, http.MethodGet, "/users/0", "token", "", ""); w.Code != http.StatusOK {
+		t.Errorf("expected AccessToken to be accepted, got %d", w.Code)
+	}
+	server.config.JWT = nil
+	r := httptest.NewRequest(http.MethodGet, "/?limit=1&offset=0&order_by=0", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set(accessTokenHeader, "token")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected bearer token to be rejected, got %d", w.Code)
+	}
+
+	// Watch reloads keys
+	server.config.JWT = verifier
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server.reloadKeys()
+	writeJWKS(t, path, testJWKS()[1])
+	server.reloadKeys()
+	if output := logs.String(); !strings.Contains(output, "JWKS reload failed, keeping keys") || !strings.Contains(output, "JWKS reloaded: 1 keys") {
+		t.Errorf("expected reloads to be logged, got %s", output)
+	}
+}
@@ -0,0 +1,79 @@
+package searchserver
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// Case folds which can't be done rune to rune.
+	caseFolds = map[rune]string{'ß': "ss", 'ẞ': "ss"}
+	// Letters without canonical decomposition, so they can't be stripped of diacritics by NFD.
+	letterFolds = map[rune]string{
+		'ø': "o", 'Ø': "o", 'ł': "l", 'Ł': "l", 'đ': "d", 'Đ': "d", 'ħ': "h", 'Ħ': "h", 'ı': "i",
+		'æ': "ae", 'Æ': "ae", 'œ': "oe", 'Œ': "oe", 'þ': "th", 'Þ': "th",
+	}
+)
+
+func foldCase(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r)) // also maps variants like final sigma to one form
+}
+
+// Append folded rune to buf. Diacritics are stripped only when requested.
+func appendFoldedRune(buf []byte, r rune, stripMarks bool) []byte {
+	if r < utf8.RuneSelf {
+		return append(buf, byte(unicode.ToLower(r)))
+	}
+	if folded, ok := caseFolds[r]; ok {
+		return append(buf, folded...)
+	}
+	if !stripMarks {
+		return utf8.AppendRune(buf, foldCase(r))
+	}
+	if folded, ok := letterFolds[r]; ok {
+		return append(buf, folded...)
+	}
+	for _, decomposed := range norm.NFD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, decomposed) {
+			buf = utf8.AppendRune(buf, foldCase(decomposed))
+		}
+	}
+	return buf
+}
+
+func foldText(text string, stripMarks bool) string {
+	buf := make([]byte, 0, len(text))
+	for _, r := range text {
+		buf = appendFoldedRune(buf, r, stripMarks)
+	}
+	return string(buf)
+}
+
+// Fold text keeping track of origin: byte i of folded text comes from rune text[starts[i]:ends[i]].
+func foldTextWithOffsets(text string, stripMarks bool) (folded string, starts, ends []int) {
+	buf := make([]byte, 0, len(text))
+	starts, ends = make([]int, 0, len(text)), make([]int, 0, len(text))
+	for i, r := range text {
+		size := len(buf)
+		buf = appendFoldedRune(buf, r, stripMarks)
+		for j := size; j < len(buf); j++ {
+			starts = append(starts, i)
+			ends = append(ends, i+utf8.RuneLen(r))
+		}
+	}
+	return string(buf), starts, ends
+}
+
+// Build text normalization for match_mode. Exact mode keeps text as is.
+func normalizer(matchMode string) func(string) string {
+	switch matchMode {
+	case MatchModeCaseInsensitive:
+		return func(text string) string { return foldText(text, false) }
+	case MatchModeFolded:
+		return func(text string) string { return foldText(text, true) }
+	default:
+		return func(text string) string { return text }
+	}
+}
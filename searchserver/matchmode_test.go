@@ -0,0 +1,43 @@
+package searchserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFoldTextWithOffsets(t *testing.T) {
+	text := "Straße José"
+	folded, starts, ends := foldTextWithOffsets(text, true)
+	if folded != "strasse jose" {
+		t.Fatalf("expected strasse jose, got %s", folded)
+	}
+	for _, item := range []struct{ folded, original string }{{"ss", "ß"}, {"jose", "José"}, {"e j", "e J"}} {
+		i := strings.Index(folded, item.folded)
+		if got := text[starts[i]:ends[i+len(item.folded)-1]]; got != item.original {
+			t.Errorf("expected %s to come from %s, got %s", item.folded, item.original, got)
+		}
+	}
+}
+
+func TestFoldText(t *testing.T) {
+	cases := []struct {
+		text, caseInsensitive, folded string
+	}{
+		{text: "Boyd Wolf", caseInsensitive: "boyd wolf", folded: "boyd wolf"},
+		{text: "José Müller", caseInsensitive: "josé müller", folded: "jose muller"},
+		{text: "STRAUSS Strauß", caseInsensitive: "strauss strauss", folded: "strauss strauss"},
+		{text: "Ødegård Łukasz", caseInsensitive: "ødegård łukasz", folded: "odegard lukasz"},
+		{text: "ΣΟΦΟΣ σοφος", caseInsensitive: "σοφοσ σοφοσ", folded: "σοφοσ σοφοσ"},
+	}
+	for caseNum, item := range cases {
+		if got := normalizer(MatchModeExact)(item.text); got != item.text {
+			t.Errorf("[%d] exact mode must keep text, got %s", caseNum, got)
+		}
+		if got := normalizer(MatchModeCaseInsensitive)(item.text); got != item.caseInsensitive {
+			t.Errorf("[%d] expected %s, got %s", caseNum, item.caseInsensitive, got)
+		}
+		if got := normalizer(MatchModeFolded)(item.text); got != item.folded {
+			t.Errorf("[%d] expected %s, got %s", caseNum, item.folded, got)
+		}
+	}
+}
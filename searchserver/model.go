@@ -0,0 +1,108 @@
+package searchserver
+
+const (
+	OrderByAsc  = -1
+	OrderByAsIs = 0
+	OrderByDesc = 1
+
+	ErrorBadOrderField = `ErrorBadOrderField`
+	ErrorBadField      = `ErrorBadField`
+	ErrorBadQuery      = `ErrorBadQuery`
+
+	QueryModeSubstring = "substring" // default: query is a plain substring
+	QueryModeBoolean   = "boolean"   // query is parsed, see parseQuery for syntax
+	QueryModeRegex     = "regex"     // query is RE2 regular expression
+
+	MatchModeExact           = "exact"            // default
+	MatchModeCaseInsensitive = "case_insensitive" // Unicode case folding
+	MatchModeFolded          = "folded"           // case folding and diacritics stripping: "jose" matches "José"
+
+	FacetGender = "gender"
+	FacetAge    = "age"
+)
+
+// User is a record of search result.
+type User struct {
+	Id     int
+	Name   string
+	Age    int
+	About  string
+	Gender string
+}
+
+// SearchErrorResponse is the body of every error response.
+type SearchErrorResponse struct {
+	Error  string
+	Detail string `json:",omitempty"` // offending value, if any ( e.g. unknown field name )
+	Pos    int    `json:",omitempty"` // 1-based position of query syntax error
+}
+
+// Highlight explains why user was found. Ranges are [start, end) byte offsets in the original field value.
+type Highlight struct {
+	Name    [][2]int `json:",omitempty"`
+	About   [][2]int `json:",omitempty"`
+	Snippet string   `json:",omitempty"`
+}
+
+// Facet is a count of matched users by field in buckets.
+type Facet struct {
+	Field    string
+	Interval int `json:",omitempty"`
+	Buckets  []FacetBucket
+}
+
+type FacetBucket struct {
+	Value string `json:",omitempty"`
+	From  int    `json:",omitempty"`
+	To    int    `json:",omitempty"`
+	Count int
+}
+
+// Suggestion is a first, last or full name starting with requested prefix.
+type Suggestion struct {
+	Text  string
+	Count int
+}
+
+// SearchRequest is a validated set of search params ( see validateSearchParams ).
+type SearchRequest struct {
+	Limit           int
+	Offset          int
+	Query           string
+	OrderField      string
+	OrderBy         int
+	Fields          []string
+	Filters         Filters
+	QueryMode       string
+	MatchMode       string
+	Fuzziness       int
+	Highlight       *HighlightOptions // nil if highlighting is not requested
+	Boosts          Boosts
+	Facets          []FacetRequest
+	SuggestDistance int
+	ResponseVersion int // ResponseVersionUser or ResponseVersionDetails
+}
+
+type FacetRequest struct {
+	Field    string
+	Interval int
+}
+
+type Boosts struct {
+	Name  float64
+	About float64
+}
+
+type HighlightOptions struct {
+	PreTag        string
+	PostTag       string
+	SnippetLength int
+}
+
+// Filters narrow down search result. Zero values are not applied.
+type Filters struct {
+	AgeMin int
+	AgeMax int
+	Gender string
+	Ids    []int
+}
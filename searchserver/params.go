@@ -0,0 +1,269 @@
+package searchserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	ageField     = "Age"
+	idField      = "Id"
+	nameField    = "Name"
+	aboutField   = "About"
+	genderField  = "Gender"
+	maleGender   = "male"
+	femaleGender = "female"
+)
+
+var (
+	BadRequestError             error = errors.New(ErrorBadOrderField)
+	OrderByInvalidError         error = errors.New("invalid order_by")
+	QueryModeInvalidError       error = errors.New("invalid query_mode")
+	MatchModeInvalidError       error = errors.New("invalid match_mode")
+	FuzzinessInvalidError       error = fmt.Errorf("fuzziness must be between 0 and %d", maxFuzziness)
+	FuzzyQueryModeError         error = errors.New("fuzziness is supported in substring query_mode only")
+	HighlightInvalidError       error = errors.New("invalid highlight")
+	RelevanceQueryModeError     error = errors.New("Relevance order requires substring or boolean query_mode without fuzziness")
+	SnippetLengthInvalidError   error = fmt.Errorf("snippet_length must be between %d and %d", minSnippetLength, maxSnippetLength)
+	SuggestDistanceError        error = fmt.Errorf("suggest_distance must be between 0 and %d", maxFuzziness)
+	SuggestQueryModeError       error = errors.New("suggest_distance is supported in substring and boolean query_mode without fuzziness")
+	OffsetInvalidError          error = errors.New("offset must not be negative")
+	ResponseVersionInvalidError error = fmt.Errorf("response_version must be %d or %d", ResponseVersionUser, ResponseVersionDetails)
+	userFields                        = []string{idField, nameField, ageField, aboutField, genderField} // in order of User struct
+)
+
+// Extract integer value of search param. Otherwise - handle error
+func getIntParam(vals url.Values, paramName string) (int, error) {
+	err_ := fmt.Errorf("invalid integer param [%s]", paramName)
+	if !vals.Has(paramName) {
+		return -1, err_
+	}
+	result, e := strconv.Atoi(vals.Get(paramName))
+	if e != nil {
+		return -1, err_
+	}
+	return result, nil
+}
+
+// Function validates request search params.
+// On empty search param - is valid ( use default).
+// Otherwise verify is search param listed in allowed values
+func validateAllowedValues(value interface{}, allowedValues ...interface{}) error {
+	for i := 0; i < len(allowedValues); i++ {
+		if value == allowedValues[i] {
+			return nil
+		}
+	}
+	return errors.New("invalid param")
+}
+
+// Parse comma-separated list of fields to return, allowed are listed in order of response struct.
+// Result keeps that order regardless of requested order, duplicates are dropped.
+func parseFields(value string, allowed []string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	requested := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(allowed, field) {
+			return nil, &badRequestError{reason: ErrorBadField, detail: field}
+		}
+		requested[field] = true
+	}
+	result := make([]string, 0, len(requested))
+	for _, field := range allowed {
+		if requested[field] {
+			result = append(result, field)
+		}
+	}
+	return result, nil
+}
+
+func filterError(paramName, reason, value string) error {
+	return &badRequestError{reason: fmt.Sprintf("invalid filter [%s]: %s", paramName, reason), detail: value}
+}
+
+// Extract optional non-negative integer filter. Absent filter is 0 ( not applied ).
+func getFilterIntParam(vals url.Values, paramName string) (int, error) {
+	if vals.Get(paramName) == "" {
+		return 0, nil
+	}
+	result, err := strconv.Atoi(vals.Get(paramName))
+	if err != nil {
+		return 0, filterError(paramName, "must be an integer", vals.Get(paramName))
+	}
+	if result < 0 {
+		return 0, filterError(paramName, "must not be negative", vals.Get(paramName))
+	}
+	return result, nil
+}
+
+func parseFilters(q url.Values) (Filters, error) {
+	filters := Filters{Gender: q.Get("gender")}
+	var err error
+	if filters.AgeMin, err = getFilterIntParam(q, "age_min"); err != nil {
+		return filters, err
+	}
+	if filters.AgeMax, err = getFilterIntParam(q, "age_max"); err != nil {
+		return filters, err
+	}
+	if filters.AgeMax != 0 && filters.AgeMin > filters.AgeMax {
+		return filters, filterError("age_min", "must not exceed age_max", q.Get("age_min"))
+	}
+	if err := validateAllowedValues(filters.Gender, "", maleGender, femaleGender); err != nil {
+		return filters, filterError("gender", "must be male or female", filters.Gender)
+	}
+	if q.Get("ids") == "" {
+		return filters, nil
+	}
+	for _, id := range strings.Split(q.Get("ids"), ",") {
+		parsed, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil || parsed < 0 {
+			return filters, filterError("ids", "must be a list of non-negative integers", id)
+		}
+		filters.Ids = append(filters.Ids, parsed)
+	}
+	return filters, nil
+}
+
+// Highlight options, nil if highlighting is not requested. Markers can be set to empty explicitly.
+func parseHighlightOptions(q url.Values) (*HighlightOptions, error) {
+	if q.Get("highlight") == "" {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(q.Get("highlight"))
+	if err != nil {
+		return nil, HighlightInvalidError
+	}
+	if !enabled {
+		return nil, nil
+	}
+	options := HighlightOptions{PreTag: defaultHighlightPre, PostTag: defaultHighlightPost, SnippetLength: defaultSnippetLength}
+	if q.Has("highlight_pre") {
+		options.PreTag = q.Get("highlight_pre")
+	}
+	if q.Has("highlight_post") {
+		options.PostTag = q.Get("highlight_post")
+	}
+	if q.Get("snippet_length") != "" {
+		options.SnippetLength, err = strconv.Atoi(q.Get("snippet_length"))
+		if err != nil || options.SnippetLength < minSnippetLength || options.SnippetLength > maxSnippetLength {
+			return nil, SnippetLengthInvalidError
+		}
+	}
+	return &options, nil
+}
+
+// Extract optional non-negative field boost. Absent boost is replaced with default.
+func getBoostParam(vals url.Values, paramName string, defaultBoost float64) (float64, error) {
+	if vals.Get(paramName) == "" {
+		return defaultBoost, nil
+	}
+	boost, err := strconv.ParseFloat(vals.Get(paramName), 64)
+	if err != nil || boost < 0 || math.IsInf(boost, 0) || math.IsNaN(boost) {
+		return 0, fmt.Errorf("invalid %s", paramName)
+	}
+	return boost, nil
+}
+
+// Validate search params. Limit must not exceed maxLimit.
+func validateSearchParams(r *http.Request, maxLimit int) (*SearchRequest, error) {
+	q := r.URL.Query()
+	limit, err := getIntParam(q, "limit")
+	if err != nil {
+		return nil, BadRequestError
+	}
+	if limit < 0 || limit > maxLimit {
+		return nil, fmt.Errorf("limit must be between 0 and %d", maxLimit)
+	}
+	offset, err := getIntParam(q, "offset")
+	if err != nil {
+		return nil, BadRequestError
+	}
+	if offset < 0 {
+		return nil, OffsetInvalidError
+	}
+	orderBy, err := getIntParam(q, "order_by")
+	if err != nil {
+		return nil, BadRequestError
+	}
+
+	if err := validateAllowedValues(orderBy, OrderByAsc, OrderByAsIs, OrderByDesc); err != nil {
+		return nil, OrderByInvalidError
+	}
+	if err := validateAllowedValues(q.Get("order_field"), "", ageField, idField, nameField, relevanceField); err != nil {
+		return nil, BadRequestError
+	}
+	responseVersion := ResponseVersionUser
+	if q.Get("response_version") != "" {
+		if responseVersion, err = strconv.Atoi(q.Get("response_version")); err != nil ||
+			validateAllowedValues(responseVersion, ResponseVersionUser, ResponseVersionDetails) != nil {
+			return nil, ResponseVersionInvalidError
+		}
+	}
+	allowedFields := userFields
+	if responseVersion == ResponseVersionDetails {
+		allowedFields = detailFields
+	}
+	fields, err := parseFields(q.Get("fields"), allowedFields)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := parseFilters(q)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAllowedValues(q.Get("query_mode"), "", QueryModeSubstring, QueryModeBoolean, QueryModeRegex); err != nil {
+		return nil, QueryModeInvalidError
+	}
+	if err := validateAllowedValues(q.Get("match_mode"), "", MatchModeExact, MatchModeCaseInsensitive, MatchModeFolded); err != nil {
+		return nil, MatchModeInvalidError
+	}
+	fuzziness := 0
+	if q.Get("fuzziness") != "" {
+		if fuzziness, err = strconv.Atoi(q.Get("fuzziness")); err != nil || fuzziness < 0 || fuzziness > maxFuzziness {
+			return nil, FuzzinessInvalidError
+		}
+	}
+	if fuzziness > 0 && q.Get("query_mode") != "" && q.Get("query_mode") != QueryModeSubstring {
+		return nil, FuzzyQueryModeError
+	}
+	if q.Get("order_field") == relevanceField && (fuzziness > 0 || q.Get("query_mode") == QueryModeRegex) {
+		return nil, RelevanceQueryModeError
+	}
+	highlight, err := parseHighlightOptions(q)
+	if err != nil {
+		return nil, err
+	}
+	boosts := Boosts{}
+	if boosts.Name, err = getBoostParam(q, "boost_name", defaultBoostName); err != nil {
+		return nil, err
+	}
+	if boosts.About, err = getBoostParam(q, "boost_about", defaultBoostAbout); err != nil {
+		return nil, err
+	}
+	suggestDistance := 0
+	if q.Get("suggest_distance") != "" {
+		if suggestDistance, err = strconv.Atoi(q.Get("suggest_distance")); err != nil || suggestDistance < 0 || suggestDistance > maxFuzziness {
+			return nil, SuggestDistanceError
+		}
+	}
+	if suggestDistance > 0 && (fuzziness > 0 || q.Get("query_mode") == QueryModeRegex) {
+		return nil, SuggestQueryModeError
+	}
+	facets, err := parseFacets(q.Get("facets"))
+	if err != nil {
+		return nil, err
+	}
+	candidate := SearchRequest{Query: q.Get("query"), Limit: limit, Offset: offset, OrderField: q.Get("order_field"), OrderBy: orderBy,
+		Fields: fields, Filters: filters, QueryMode: q.Get("query_mode"), MatchMode: q.Get("match_mode"), Fuzziness: fuzziness,
+		Highlight: highlight, Boosts: boosts, Facets: facets, SuggestDistance: suggestDistance, ResponseVersion: responseVersion}
+	return &candidate, nil
+}
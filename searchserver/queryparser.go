@@ -0,0 +1,296 @@
+package searchserver
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	queryFieldName  = "name"
+	queryFieldAbout = "about"
+)
+
+// User text prepared for matching, normalized accordingly to match_mode.
+type searchDoc struct {
+	id    int
+	name  string
+	about string
+}
+
+// Node of parsed boolean query.
+type queryNode interface {
+	eval(doc *searchDoc) bool
+}
+
+// Substring in field. Empty field means any of Name and About.
+type termNode struct {
+	field string
+	text  string
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+type notNode struct {
+	operand queryNode
+}
+
+func (n *termNode) eval(doc *searchDoc) bool {
+	switch n.field {
+	case queryFieldName:
+		return strings.Contains(doc.name, n.text)
+	case queryFieldAbout:
+		return strings.Contains(doc.about, n.text)
+	default:
+		return strings.Contains(doc.name, n.text) || strings.Contains(doc.about, n.text)
+	}
+}
+
+func (n *andNode) eval(doc *searchDoc) bool { return n.left.eval(doc) && n.right.eval(doc) }
+
+func (n *orNode) eval(doc *searchDoc) bool { return n.left.eval(doc) || n.right.eval(doc) }
+
+func (n *notNode) eval(doc *searchDoc) bool { return !n.operand.eval(doc) }
+
+// Replace text of every term of query with fn(text).
+func mapTerms(node queryNode, fn func(string) string) {
+	switch n := node.(type) {
+	case *termNode:
+		n.text = fn(n.text)
+	case *andNode:
+		mapTerms(n.left, fn)
+		mapTerms(n.right, fn)
+	case *orNode:
+		mapTerms(n.left, fn)
+		mapTerms(n.right, fn)
+	case *notNode:
+		mapTerms(n.operand, fn)
+	}
+}
+
+// Query parse error. Position is 1-based and counted in characters.
+type querySyntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *querySyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.msg, e.pos)
+}
+
+type queryTokenKind int
+
+const (
+	tokenTerm queryTokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLeftParen
+	tokenRightParen
+	tokenEnd
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	field string
+	text  string
+	pos   int
+}
+
+// Read quoted phrase starting at runes[start] == '"'. Returns phrase and index right after closing quote.
+func lexPhrase(runes []rune, start int) (string, int, error) {
+	var phrase strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			return phrase.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+		}
+		phrase.WriteRune(runes[i])
+	}
+	return "", len(runes), &querySyntaxError{pos: start + 1, msg: "unterminated phrase"}
+}
+
+func lexQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := make([]queryToken, 0, 8)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLeftParen, pos: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRightParen, pos: i + 1})
+			i++
+		case r == '"':
+			phrase, next, err := lexPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokenTerm, text: phrase, pos: i + 1})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()"`, runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			switch word {
+			case "AND":
+				tokens = append(tokens, queryToken{kind: tokenAnd, pos: start + 1})
+				continue
+			case "OR":
+				tokens = append(tokens, queryToken{kind: tokenOr, pos: start + 1})
+				continue
+			case "NOT":
+				tokens = append(tokens, queryToken{kind: tokenNot, pos: start + 1})
+				continue
+			}
+			token := queryToken{kind: tokenTerm, text: word, pos: start + 1}
+			if field, text, scoped := strings.Cut(word, ":"); scoped {
+				if field != queryFieldName && field != queryFieldAbout {
+					return nil, &querySyntaxError{pos: start + 1, msg: fmt.Sprintf("unknown field %q", field)}
+				}
+				token.field, token.text = field, text
+				if text == "" { // field-scoped phrase: name:"Boyd Wolf"
+					if i == len(runes) || runes[i] != '"' {
+						return nil, &querySyntaxError{pos: i + 1, msg: "missing term after " + word}
+					}
+					phrase, next, err := lexPhrase(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					token.text, i = phrase, next
+				}
+			}
+			tokens = append(tokens, token)
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEnd, pos: len(runes) + 1}), nil
+}
+
+// Recursive descent parser. Grammar ( NOT binds tighter than AND, AND binds tighter than OR ):
+//
+//	or      = and { "OR" and }
+//	and     = unary { [ "AND" ] unary }
+//	unary   = "NOT" unary | primary
+//	primary = "(" or ")" | [ field ":" ] ( word | phrase )
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) advance() queryToken {
+	token := p.tokens[p.next]
+	if token.kind != tokenEnd {
+		p.next++
+	}
+	return token
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.advance()
+		case tokenTerm, tokenNot, tokenLeftParen: // implicit AND
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind != tokenNot {
+		return p.parsePrimary()
+	}
+	p.advance()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &notNode{operand: operand}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	token := p.advance()
+	switch token.kind {
+	case tokenTerm:
+		return &termNode{field: token.field, text: token.text}, nil
+	case tokenLeftParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRightParen {
+			return nil, &querySyntaxError{pos: closing.pos, msg: "expected ')'"}
+		}
+		return node, nil
+	case tokenEnd:
+		return nil, &querySyntaxError{pos: token.pos, msg: "unexpected end of query"}
+	case tokenRightParen:
+		return nil, &querySyntaxError{pos: token.pos, msg: "unexpected ')'"}
+	default:
+		return nil, &querySyntaxError{pos: token.pos, msg: "unexpected operator"}
+	}
+}
+
+// Parse boolean query into AST. Empty query matches every record.
+func parseQuery(query string) (queryNode, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return &termNode{}, nil
+	}
+	parser := queryParser{tokens: tokens}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEnd {
+		return nil, &querySyntaxError{pos: token.pos, msg: "unexpected ')'"}
+	}
+	return node, nil
+}
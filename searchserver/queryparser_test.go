@@ -0,0 +1,54 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected queryNode
+	}{
+		{query: "", expected: &termNode{}},
+		{query: `name:Boyd`, expected: &termNode{field: queryFieldName, text: "Boyd"}},
+		{query: `about:"commodo ex"`, expected: &termNode{field: queryFieldAbout, text: "commodo ex"}},
+		{query: `"say \"hi\""`, expected: &termNode{text: `say "hi"`}},
+		{query: `a b OR c`, expected: &orNode{
+			left:  &andNode{left: &termNode{text: "a"}, right: &termNode{text: "b"}},
+			right: &termNode{text: "c"}}},
+		{query: `NOT a AND (b OR c)`, expected: &andNode{
+			left:  &notNode{operand: &termNode{text: "a"}},
+			right: &orNode{left: &termNode{text: "b"}, right: &termNode{text: "c"}}}},
+	}
+	for caseNum, item := range cases {
+		node, err := parseQuery(item.query)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+		}
+		if !reflect.DeepEqual(item.expected, node) {
+			t.Errorf("[%d] wrong AST for %q, expected %#v, got %#v", caseNum, item.query, item.expected, node)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	cases := []struct {
+		query string
+		err   string
+	}{
+		{query: `(a OR b`, err: "expected ')' at position 8"},
+		{query: `a)`, err: "unexpected ')' at position 2"},
+		{query: `a AND`, err: "unexpected end of query at position 6"},
+		{query: `OR a`, err: "unexpected operator at position 1"},
+		{query: `a "b c`, err: "unterminated phrase at position 3"},
+		{query: `email:x`, err: `unknown field "email" at position 1`},
+		{query: `name: Boyd`, err: "missing term after name: at position 6"},
+	}
+	for caseNum, item := range cases {
+		_, err := parseQuery(item.query)
+		if err == nil || err.Error() != item.err {
+			t.Errorf("[%d] expected error [%s] for %q, got [%v]", caseNum, item.err, item.query, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package searchserver
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxRateLimitBuckets = 10000 // least recently used bucket is dropped for a new one when there are as many
+
+// RateLimit is a token bucket: Burst requests at once, then Rate requests per second.
+type RateLimit struct {
+	Rate  float64 // requests per second, no limit if 0
+	Burst int     // 1 if 0
+}
+
+// rateLimiter keeps a bucket by key ( token name or client IP ).
+type rateLimiter struct {
+	limit   RateLimit
+	mu      sync.Mutex
+	buckets map[string]*list.Element // of used
+	used    *list.List               // of *rateBucket, recently used first
+}
+
+type rateBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateDecision of a request, reported to client with RateLimit-* headers.
+type rateDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // until bucket is full
+	retryAfter time.Duration // until the next request is allowed, if not allowed
+}
+
+// Nil if limit is off.
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	return &rateLimiter{limit: limit, buckets: make(map[string]*list.Element), used: list.New()}
+}
+
+func (limiter *rateLimiter) take(key string, now time.Time) rateDecision {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	burst, rate := float64(limiter.limit.Burst), limiter.limit.Rate
+	element, ok := limiter.buckets[key]
+	if ok {
+		limiter.used.MoveToFront(element)
+	} else {
+		if limiter.used.Len() >= maxRateLimitBuckets { // the oldest one, it is the most likely to be full
+			delete(limiter.buckets, limiter.used.Remove(limiter.used.Back()).(*rateBucket).key)
+		}
+		element = limiter.used.PushFront(&rateBucket{key: key, tokens: burst, last: now})
+		limiter.buckets[key] = element
+	}
+	bucket := element.Value.(*rateBucket)
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed*rate)
+		bucket.last = now
+	}
+	decision := rateDecision{limit: limiter.limit.Burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.allowed = true
+	} else {
+		decision.retryAfter = seconds((1 - bucket.tokens) / rate)
+	}
+	decision.remaining = int(bucket.tokens)
+	decision.reset = seconds((burst - bucket.tokens) / rate)
+	return decision
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// Take a request of key from limiter, if it is set. Headers describe the bucket, 429 is written when
+// it is empty.
+func (limiter *rateLimiter) allow(w http.ResponseWriter, key string) bool {
+	if limiter == nil {
+		return true
+	}
+	decision := limiter.take(key, time.Now())
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(decision.limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.reset)))
+	if !decision.allowed {
+		header.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(decision.retryAfter))))
+		handleErrorResponse(w, http.StatusTooManyRequests, "too many requests")
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Address of client without port, proxies are not trusted.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,98 @@
+package searchserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(RateLimit{}) != nil {
+		t.Errorf("expected limit to be off without rate")
+	}
+	limiter := newRateLimiter(RateLimit{Rate: 2, Burst: 3})
+	start := time.Unix(1_800_000_000, 0)
+	cases := []struct {
+		key      string
+		at       time.Duration
+		expected rateDecision
+	}{
+		{"a", 0, rateDecision{allowed: true, limit: 3, remaining: 2, reset: 500 * time.Millisecond}},
+		{"a", 0, rateDecision{allowed: true, limit: 3, remaining: 1, reset: time.Second}},
+		{"a", 0, rateDecision{allowed: true, limit: 3, remaining: 0, reset: 1500 * time.Millisecond}},
+		{"a", 0, rateDecision{limit: 3, remaining: 0, reset: 1500 * time.Millisecond, retryAfter: 500 * time.Millisecond}},
+		{"b", 0, rateDecision{allowed: true, limit: 3, remaining: 2, reset: 500 * time.Millisecond}}, // own bucket
+		{"a", 250 * time.Millisecond, rateDecision{limit: 3, remaining: 0, reset: 1250 * time.Millisecond, retryAfter: 250 * time.Millisecond}},
+		{"a", 500 * time.Millisecond, rateDecision{allowed: true, limit: 3, remaining: 0, reset: 1500 * time.Millisecond}},
+		{"a", 10 * time.Second, rateDecision{allowed: true, limit: 3, remaining: 2, reset: 500 * time.Millisecond}}, // not more than burst
+	}
+	for caseNum, item := range cases {
+		if decision := limiter.take(item.key, start.Add(item.at)); decision != item.expected {
+			t.Errorf("[%d] expected %+v, got %+v", caseNum, item.expected, decision)
+		}
+	}
+
+	// least recently used buckets are dropped to keep memory bounded
+	limiter = newRateLimiter(RateLimit{Rate: 1})
+	for i := 0; i < maxRateLimitBuckets+100; i++ {
+		limiter.take(fmt.Sprint(i), start.Add(time.Duration(i)))
+	}
+	if len(limiter.buckets) != maxRateLimitBuckets || limiter.used.Len() != maxRateLimitBuckets {
+		t.Errorf("expected %d buckets, got %d", maxRateLimitBuckets, len(limiter.buckets))
+	}
+	if decision := limiter.take("100", start); decision.allowed {
+		t.Errorf("expected bucket used lately to be kept")
+	}
+	if decision := limiter.take("99", start); !decision.allowed {
+		t.Errorf("expected the oldest bucket to be dropped")
+	}
+	if _, ok := limiter.buckets["101"]; ok || len(limiter.buckets) != maxRateLimitBuckets {
+		t.Errorf("expected bucket used least recently to be dropped for a new one, got %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestRateLimitServer(t *testing.T) {
+	server := newUsersTestServer(t, Config{})
+	server.tokenLimiter = newRateLimiter(RateLimit{Rate: 0.001, Burst: 2})
+	server.ipLimiter = newRateLimiter(RateLimit{Rate: 0.001, Burst: 4})
+	request := func(token, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/?limit=1&offset=0&order_by=0", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set(accessTokenHeader, token)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	cases := []struct {
+		token, ip   string
+		status      int
+		remaining   string
+		retryAfter  string
+		description string
+	}{
+		{"token", "10.0.0.1", http.StatusOK, "1", "", "token bucket"},
+		{"token", "10.0.0.1", http.StatusOK, "0", "", "token bucket"},
+		{"token", "10.0.0.2", http.StatusTooManyRequests, "0", "1000", "token bucket of another IP"},
+		{"admin", "10.0.0.1", http.StatusOK, "1", "", "bucket of another token"},
+		{"invalid", "10.0.0.1", http.StatusUnauthorized, "0", "", "IP bucket of unauthorized request"},
+		{"admin", "10.0.0.1", http.StatusTooManyRequests, "0", "1000", "IP bucket"},
+		{"admin", "10.0.0.3", http.StatusOK, "0", "", "token bucket of another IP"},
+	}
+	for caseNum, item := range cases {
+		w := request(item.token, item.ip)
+		header := w.Header()
+		if w.Code != item.status || header.Get("RateLimit-Remaining") != item.remaining || header.Get("Retry-After") != item.retryAfter {
+			t.Errorf("[%d] %s: expected %d remaining %s retry after %q, got %d %v %s", caseNum, item.description, item.status,
+				item.remaining, item.retryAfter, w.Code, header, w.Body)
+		}
+	}
+	if w := request("token", "10.0.0.4"); w.Body.String() != `{"Error":"too many requests"}` || w.Header().Get("RateLimit-Limit") != "2" ||
+		w.Header().Get("RateLimit-Reset") != "2000" {
+		t.Errorf("unexpected response %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	if ip := clientIP(&http.Request{RemoteAddr: "pipe"}); ip != "pipe" {
+		t.Errorf("expected address without port, got %s", ip)
+	}
+}
@@ -0,0 +1,120 @@
+package searchserver
+
+import (
+	"container/list"
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"sync"
+	"time"
+)
+
+const (
+	maxRegexLength = 256  // bytes of pattern
+	maxRegexInsts  = 2000 // instructions of compiled program, x{1000} is cheap to write but not to run
+	regexCacheSize = 128
+
+	defaultRegexMatchTimeout = 200 * time.Millisecond
+)
+
+var (
+	RegexTooLongError   = &badRequestError{reason: "regex is too long"}
+	RegexComplexError   = &badRequestError{reason: "regex is too complex"}
+	RegexMatchModeError = &badRequestError{reason: "regex supports exact and case_insensitive match_mode only"}
+	compiledRegexCache  = newRegexCache(regexCacheSize)
+
+	// Not a fault of client, search is answered with 503.
+	RegexTimeoutError error = errors.New("regex match timed out")
+)
+
+// LRU cache of compiled patterns. Regexp is safe for concurrent use, so cached values are shared.
+type regexCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is most recently used
+	items    map[string]*list.Element
+}
+
+type regexCacheItem struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newRegexCache(capacity int) *regexCache {
+	return &regexCache{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *regexCache) get(pattern string) (*regexp.Regexp, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[pattern]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(item)
+	return item.Value.(*regexCacheItem).re, true
+}
+
+func (c *regexCache) put(pattern string, re *regexp.Regexp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[pattern]; ok {
+		c.order.MoveToFront(item)
+		return
+	}
+	c.items[pattern] = c.order.PushFront(&regexCacheItem{pattern: pattern, re: re})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Remove(c.order.Back()).(*regexCacheItem)
+		delete(c.items, oldest.pattern)
+	}
+}
+
+// Compile pattern with RE2 engine, checking size and complexity budget first.
+func compileRegex(pattern string, matchMode string) (*regexp.Regexp, error) {
+	if len(pattern) > maxRegexLength {
+		return nil, RegexTooLongError
+	}
+	switch matchMode {
+	case MatchModeCaseInsensitive:
+		pattern = "(?i)" + pattern
+	case MatchModeFolded:
+		return nil, RegexMatchModeError
+	}
+	if re, ok := compiledRegexCache.get(pattern); ok {
+		return re, nil
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) && (syntaxErr.Code == syntax.ErrInvalidRepeatSize || syntaxErr.Code == syntax.ErrLarge ||
+		syntaxErr.Code == syntax.ErrNestingDepth) { // RE2 own limits, which are way above our budget
+		return nil, RegexComplexError
+	}
+	if err != nil {
+		return nil, &badRequestError{reason: "invalid regex: " + err.Error(), detail: pattern}
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil || len(prog.Inst) > maxRegexInsts {
+		return nil, RegexComplexError
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &badRequestError{reason: "invalid regex: " + err.Error(), detail: pattern}
+	}
+	compiledRegexCache.put(pattern, re)
+	return re, nil
+}
+
+// Regex in Name. Matching stops once deadline is passed.
+type regexNode struct {
+	re       *regexp.Regexp
+	deadline time.Time
+	timedOut bool
+}
+
+func (n *regexNode) eval(doc *searchDoc) bool {
+	if n.timedOut || time.Now().After(n.deadline) {
+		n.timedOut = true
+		return false
+	}
+	return n.re.MatchString(doc.name)
+}
@@ -0,0 +1,44 @@
+package searchserver
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCompileRegexBudget(t *testing.T) {
+	cases := []struct {
+		pattern string
+		err     error
+	}{
+		{pattern: strings.Repeat("a", maxRegexLength+1), err: RegexTooLongError},
+		{pattern: "(a{1000}){1000}", err: RegexComplexError},
+		{pattern: "a{1000}b{1000}", err: RegexComplexError},
+		{pattern: "((((a{100}){100}){100}){100})", err: RegexComplexError},
+	}
+	for caseNum, item := range cases {
+		if _, err := compileRegex(item.pattern, MatchModeExact); !errors.Is(err, item.err) {
+			t.Errorf("[%d] expected error [%s], got [%v]", caseNum, item.err, err)
+		}
+	}
+}
+
+func TestRegexCache(t *testing.T) {
+	cache := newRegexCache(2)
+	for _, pattern := range []string{"a", "b", "a", "c"} { // b is evicted as least recently used
+		if _, ok := cache.get(pattern); !ok {
+			cache.put(pattern, regexp.MustCompile(pattern))
+		}
+	}
+	for pattern, cached := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := cache.get(pattern); ok != cached {
+			t.Errorf("pattern %s expected to be cached: %v", pattern, cached)
+		}
+	}
+	first, _ := compileRegex("^B.*(Wolf|Bauer)$", MatchModeExact)
+	second, _ := compileRegex("^B.*(Wolf|Bauer)$", MatchModeExact)
+	if first == nil || first != second {
+		t.Errorf("expected the same compiled regex from cache, got %p and %p", first, second)
+	}
+}
@@ -0,0 +1,117 @@
+package searchserver
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	relevanceField    = "Relevance"
+	bm25K1            = 1.2
+	bm25B             = 0.75
+	defaultBoostName  = 2.0
+	defaultBoostAbout = 1.0
+)
+
+// Words of text for scoring: runs of letters and digits, folded ( case and diacritics ).
+func tokenizeWords(text string) []string {
+	return strings.FieldsFunc(foldText(text, true), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// Term statistics of one field over all users.
+type fieldStats struct {
+	freqs     map[int]map[string]int // user id -> term -> frequency
+	lengths   map[int]int            // user id -> number of terms
+	docFreq   map[string]int         // term -> number of users having it
+	avgLength float64
+}
+
+func buildFieldStats(users []UserEntry, value func(entry *UserEntry) string) *fieldStats {
+	stats := &fieldStats{freqs: make(map[int]map[string]int), lengths: make(map[int]int), docFreq: make(map[string]int)}
+	total := 0
+	for i := range users {
+		words := tokenizeWords(value(&users[i]))
+		freqs := make(map[string]int, len(words))
+		for _, word := range words {
+			if freqs[word] == 0 {
+				stats.docFreq[word]++
+			}
+			freqs[word]++
+		}
+		stats.freqs[users[i].Id] = freqs
+		stats.lengths[users[i].Id] = len(words)
+		total += len(words)
+	}
+	if len(users) > 0 {
+		stats.avgLength = float64(total) / float64(len(users))
+	}
+	return stats
+}
+
+// BM25 of term in field of user.
+func (stats *fieldStats) score(id int, term string, usersCount int) float64 {
+	tf := float64(stats.freqs[id][term])
+	if tf == 0 {
+		return 0
+	}
+	df := float64(stats.docFreq[term])
+	idf := math.Log(1 + (float64(usersCount)-df+0.5)/(df+0.5))
+	norm := 1 - bm25B + bm25B*float64(stats.lengths[id])/stats.avgLength
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+type bm25Index struct {
+	usersCount int
+	name       *fieldStats
+	about      *fieldStats
+}
+
+func buildBM25Index(users []UserEntry) *bm25Index {
+	return &bm25Index{
+		usersCount: len(users),
+		name:       buildFieldStats(users, func(entry *UserEntry) string { return entry.FirstName + " " + entry.LastName }),
+		about:      buildFieldStats(users, func(entry *UserEntry) string { return entry.About }),
+	}
+}
+
+// Words of query terms, which contribute to score. Terms under NOT don't.
+func relevanceTerms(query queryNode) []termNode {
+	terms := []termNode{}
+	for _, term := range positiveTerms(query, false, nil) {
+		for _, word := range tokenizeWords(term.text) {
+			terms = append(terms, termNode{field: term.field, text: word})
+		}
+	}
+	return terms
+}
+
+// Score of user: sum of per field BM25 of query words, multiplied by field boosts.
+func (index *bm25Index) score(id int, terms []termNode, boosts Boosts) float64 {
+	score := 0.0
+	for _, term := range terms {
+		if term.field != queryFieldAbout {
+			score += boosts.Name * index.name.score(id, term.text, index.usersCount)
+		}
+		if term.field != queryFieldName {
+			score += boosts.About * index.about.score(id, term.text, index.usersCount)
+		}
+	}
+	return score
+}
+
+// Most relevant first ( or least relevant for OrderByAsc ), ties are broken by Id.
+func sortByRelevance(searchParams *SearchRequest, users []User, scores map[int]float64) {
+	sort.Slice(users, func(i, j int) bool {
+		left, right := scores[users[i].Id], scores[users[j].Id]
+		switch {
+		case left == right:
+			return users[i].Id < users[j].Id
+		case searchParams.OrderBy == OrderByAsc:
+			return left < right
+		default:
+			return left > right
+		}
+	})
+}
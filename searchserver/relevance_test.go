@@ -0,0 +1,33 @@
+package searchserver
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBM25Score(t *testing.T) {
+	users := []UserEntry{
+		{Id: 1, FirstName: "Boyd", LastName: "Wolf", About: "commodo commodo ex"},
+		{Id: 2, FirstName: "Hilda", LastName: "Mayer", About: "commodo"},
+		{Id: 3, FirstName: "Bell", LastName: "Bauer", About: "ex ex ex ex"},
+	}
+	index := buildBM25Index(users)
+	// "commodo" is in 2 of 3 about fields: idf = ln(1 + 1.5/2.5), avg about length is 8/3
+	idf := math.Log(1 + 1.5/2.5)
+	expected := idf * 2 * 2.2 / (2 + 1.2*(0.25+0.75*3/(8.0/3)))
+	terms := []termNode{{text: "commodo"}}
+	if got := index.score(1, terms, Boosts{Name: 2, About: 1}); math.Abs(got-expected) > 1e-9 {
+		t.Errorf("expected score %f, got %f", expected, got)
+	}
+	if got := index.score(1, terms, Boosts{Name: 2, About: 3}); math.Abs(got-3*expected) > 1e-9 {
+		t.Errorf("expected boosted score %f, got %f", 3*expected, got)
+	}
+	if got := index.score(3, terms, Boosts{Name: 2, About: 1}); got != 0 {
+		t.Errorf("expected zero score for user without term, got %f", got)
+	}
+	nameTerms := []termNode{{field: queryFieldName, text: "wolf"}}
+	if boosted, plain := index.score(1, nameTerms, Boosts{Name: 2, About: 1}), index.score(1, nameTerms, Boosts{Name: 1, About: 1}); plain == 0 ||
+		math.Abs(boosted-2*plain) > 1e-9 {
+		t.Errorf("expected name score %f to be doubled, got %f", plain, boosted)
+	}
+}
@@ -0,0 +1,158 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DatasetVersion describes dataset served at the moment.
+type DatasetVersion struct {
+	Version   string // hash of dataset file content
+	Users     int
+	ModTime   time.Time // of the file when it was loaded
+	LoadedAt  time.Time
+	LastError string `json:",omitempty"` // of the last failed reload, cleared by successful one
+}
+
+func (s *Server) Version() DatasetVersion {
+	return s.version(s.data.Load())
+}
+
+func (s *Server) version(data *dataset) DatasetVersion {
+	version := DatasetVersion{Version: data.version, Users: len(data.members), ModTime: data.modTime, LoadedAt: data.loadedAt}
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if s.reloadErr != nil {
+		version.LastError = s.reloadErr.Error()
+	}
+	return version
+}
+
+func (s *Server) setReloadError(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	s.reloadErr = err
+}
+
+// Reload reads dataset file and swaps served dataset if file content has changed.
+// Requests in progress finish with the dataset they started with. Broken file is reported
+// and served dataset is kept.
+func (s *Server) Reload() (DatasetVersion, error) {
+	return s.reload(true)
+}
+
+// Reload file when forced or when its modification time or size differ from the last seen ones, version of
+// other repositories is checked every time. Content hash decides whether dataset is rebuilt: touching a file
+// doesn't rebuild anything.
+func (s *Server) reload(force bool) (DatasetVersion, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	current := s.data.Load()
+	changed, err := s.fileChanged()
+	if err != nil {
+		return s.failReload(current, err)
+	}
+	if !force && !changed {
+		return s.version(current), nil
+	}
+	data, err := loadDataset(s.repository, s.config.MaxRows, current.version)
+	if err != nil {
+		return s.failReload(current, err)
+	}
+	if data == nil {
+		s.setReloadError(nil)
+		return s.version(current), nil
+	}
+	data.modTime = s.seenModTime
+	s.data.Store(data)
+	s.setReloadError(nil)
+	s.config.Logger.Printf("dataset reloaded: version %s, %d users", data.version, len(data.members))
+	return s.version(data), nil
+}
+
+// Dataset file is checked by modification time and size before it is read, broken file is not read again
+// until it changes. Repositories other than files are always changed.
+func (s *Server) fileChanged() (bool, error) {
+	file, ok := s.repository.(*FileRepository)
+	if !ok {
+		return true, nil
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return false, fmt.Errorf("error reading dataset file [%s]: %w", file.Path, err)
+	}
+	changed := !info.ModTime().Equal(s.seenModTime) || info.Size() != s.seenSize
+	s.seenModTime, s.seenSize = info.ModTime(), info.Size()
+	return changed, nil
+}
+
+// Keys are kept when JWKS file is broken.
+func (s *Server) reloadKeys() {
+	if s.config.JWT == nil {
+		return
+	}
+	if changed, err := s.config.JWT.Reload(); err != nil {
+		s.config.Logger.Printf("JWKS reload failed, keeping keys: %s", err)
+	} else if changed {
+		s.config.Logger.Printf("JWKS reloaded: %d keys", len(*s.config.JWT.keys.Load()))
+	}
+}
+
+func (s *Server) failReload(current *dataset, err error) (DatasetVersion, error) {
+	s.setReloadError(err)
+	s.config.Logger.Printf("dataset reload failed, keeping version %s: %s", current.version, err)
+	return s.version(current), err
+}
+
+// Watch polls dataset file ( and JWKS file of Config.JWT ) every Config.ReloadInterval and reloads it when
+// changed, until ctx is done. Does nothing if ReloadInterval is not positive.
+func (s *Server) Watch(ctx context.Context) {
+	if s.config.ReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload(false) // failure is logged, old dataset is kept
+			s.reloadKeys()
+		}
+	}
+}
+
+// GET /admin/dataset reports dataset version, POST /admin/reload reloads dataset and reports new version.
+func (s *Server) admin(w http.ResponseWriter, r *http.Request) {
+	var version DatasetVersion
+	switch {
+	case r.URL.Path == "/admin/dataset" && r.Method == http.MethodGet:
+		version = s.Version()
+	case r.URL.Path == "/admin/reload" && r.Method == http.MethodPost:
+		var err error
+		if version, err = s.Reload(); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, SearchErrorResponse{Error: "reload failed", Detail: err.Error()})
+			return
+		}
+	case r.URL.Path == "/admin/dataset" || r.URL.Path == "/admin/reload":
+		handleErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	default:
+		handleErrorResponse(w, http.StatusNotFound, "not found")
+		return
+	}
+	response, err := json.Marshal(version)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(response); err != nil {
+		panic("failed to process response")
+	}
+}
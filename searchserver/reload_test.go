@@ -0,0 +1,151 @@
+package searchserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	reloadTestUser  = `<row><id>1</id><first_name>Ada</first_name><last_name>Lovelace</last_name><age>36</age><about>First programmer</about><gender>female</gender></row>`
+	reloadTestUser2 = `<row><id>2</id><first_name>Alan</first_name><last_name>Turing</last_name><age>41</age><about>Codebreaker</about><gender>male</gender></row>`
+)
+
+func writeDataset(t *testing.T, path string, rows ...string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("<root>"+strings.Join(rows, "")+"</root>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newReloadTestServer(t *testing.T, config Config) (*Server, *bytes.Buffer) {
+	t.Helper()
+	logs := &bytes.Buffer{}
+	config.DatasetPath, config.Logger = filepath.Join(t.TempDir(), "dataset.xml"), log.New(logs, "", 0)
+	config.Tokens, config.AdminTokens = []string{"token"}, []string{"admin"}
+	writeDataset(t, config.DatasetPath, reloadTestUser)
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return server, logs
+}
+
+func searchNames(t *testing.T, server *Server, query string) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/?limit=10&offset=0&order_by=0&fields=Name&query="+query, nil)
+	r.Header.Set(accessTokenHeader, "token")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w.Body.String()
+}
+
+func TestReload(t *testing.T) {
+	server, logs := newReloadTestServer(t, Config{})
+	initial := server.Version()
+	if initial.Version == "" || initial.Users != 1 || initial.LastError != "" {
+		t.Fatalf("unexpected initial version %#v", initial)
+	}
+
+	// unchanged content keeps dataset
+	if version, err := server.Reload(); err != nil || version.LoadedAt != initial.LoadedAt {
+		t.Errorf("expected dataset to be kept, got %#v, %v", version, err)
+	}
+
+	writeDataset(t, server.config.DatasetPath, reloadTestUser, reloadTestUser2)
+	version, err := server.Reload()
+	if err != nil || version.Version == initial.Version || version.Users != 2 {
+		t.Fatalf("expected new version with 2 users, got %#v, %v", version, err)
+	}
+	if got := searchNames(t, server, "Turing"); got != `[{"Name":"Alan Turing"}]` {
+		t.Errorf("expected new user to be found, got %s", got)
+	}
+
+	// broken and invalid files keep served dataset
+	for _, content := range []string{"<root><row><id>3</id>", "<root>" + reloadTestUser + reloadTestUser + "</root>"} {
+		if err := os.WriteFile(server.config.DatasetPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		failed, err := server.Reload()
+		if err == nil || failed.Version != version.Version || failed.LastError != err.Error() {
+			t.Errorf("expected reload error and version %s, got %#v, %v", version.Version, failed, err)
+		}
+		if got := searchNames(t, server, "Turing"); got != `[{"Name":"Alan Turing"}]` {
+			t.Errorf("expected old dataset to be served, got %s", got)
+		}
+	}
+	if !strings.Contains(logs.String(), "duplicate id 1") || !strings.Contains(logs.String(), "keeping version "+version.Version) {
+		t.Errorf("expected reload failures to be logged, got %s", logs)
+	}
+
+	writeDataset(t, server.config.DatasetPath, reloadTestUser2)
+	if fixed, err := server.Reload(); err != nil || fixed.Users != 1 || fixed.LastError != "" {
+		t.Errorf("expected fixed file to be loaded, got %#v, %v", fixed, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server, _ := newReloadTestServer(t, Config{ReloadInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.Watch(ctx)
+		close(done)
+	}()
+	writeDataset(t, server.config.DatasetPath, reloadTestUser, reloadTestUser2)
+	for deadline := time.Now().Add(5 * time.Second); server.Version().Users != 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("changed dataset was not reloaded, version %#v", server.Version())
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	server, _ := newReloadTestServer(t, Config{})
+	cases := []struct {
+		method, path, token string
+		status              int
+	}{
+		{method: http.MethodGet, path: "/admin/dataset", token: "admin", status: http.StatusOK},
+		{method: http.MethodPost, path: "/admin/reload", token: "admin", status: http.StatusOK},
+		{method: http.MethodGet, path: "/admin/dataset", token: "token", status: http.StatusForbidden},
+		{method: http.MethodGet, path: "/admin/reload", token: "admin", status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/admin/unknown", token: "admin", status: http.StatusNotFound},
+	}
+	for caseNum, item := range cases {
+		r := httptest.NewRequest(item.method, item.path, nil)
+		r.Header.Set(accessTokenHeader, item.token)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != item.status {
+			t.Errorf("[%d] expected status %d, got %d", caseNum, item.status, w.Code)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		version := DatasetVersion{}
+		if err := json.NewDecoder(w.Body).Decode(&version); err != nil || version.Version != server.Version().Version {
+			t.Errorf("[%d] expected version %s, got %#v, %v", caseNum, server.Version().Version, version, err)
+		}
+	}
+
+	writeDataset(t, server.config.DatasetPath, "<row>")
+	r := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	r.Header.Set(accessTokenHeader, "admin")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if body, _ := io.ReadAll(w.Body); w.Code != http.StatusInternalServerError || !strings.Contains(string(body), "reload failed") {
+		t.Errorf("expected reload failure, got %d %s", w.Code, body)
+	}
+}
@@ -0,0 +1,379 @@
+package searchserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatXML   = "xml"   // <root><row>...</row></root>, as dataset.xml
+	FormatJSON  = "json"  // array of objects
+	FormatJSONL = "jsonl" // object per line
+	FormatCSV   = "csv"   // header row with names of columns, then row per user
+)
+
+// UserRepository is a source of dataset users.
+type UserRepository interface {
+	// Users reads all users, not more than maxRows ( unless 0 ). Every user is validated.
+	Users(maxRows int) ([]UserEntry, error)
+	// Version identifies content of the source: a dataset with the same version is not loaded again.
+	Version() (string, error)
+}
+
+// FileRepository reads users from a file in one of Format* formats.
+type FileRepository struct {
+	Path   string
+	Format string
+}
+
+// NewFileRepository picks format by file extension if format is empty.
+func NewFileRepository(path, format string) (*FileRepository, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "ndjson" {
+			format = FormatJSONL
+		}
+	}
+	if err := validateAllowedValues(format, FormatXML, FormatJSON, FormatJSONL, FormatCSV); err != nil {
+		return nil, fmt.Errorf("unknown dataset format %q of [%s]", format, path)
+	}
+	return &FileRepository{Path: path, Format: format}, nil
+}
+
+// contentLoader reads users and version of the same content at once.
+type contentLoader interface {
+	load(maxRows int) ([]UserEntry, string, error)
+}
+
+func (repository *FileRepository) Users(maxRows int) ([]UserEntry, error) {
+	members, _, err := repository.load(maxRows)
+	return members, err
+}
+
+// File is hashed while it is decoded, so it is read once and version is of the content users come from.
+func (repository *FileRepository) load(maxRows int) ([]UserEntry, string, error) {
+	file, err := os.Open(repository.Path)
+	if err != nil { // handle any problem of file read
+		return nil, "", fmt.Errorf("error reading dataset file [%s]: %w", repository.Path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	members, err := decodeUsers(io.TeeReader(file, hash), repository.Format, maxRows)
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing %s [%s]: %w", repository.Format, repository.Path, err)
+	}
+	if _, err := io.Copy(hash, file); err != nil { // after the last row
+		return nil, "", fmt.Errorf("error reading dataset file [%s]: %w", repository.Path, err)
+	}
+	return members, contentVersion(hash), nil
+}
+
+// Version is a hash of file content, file is read without parsing it.
+func (repository *FileRepository) Version() (string, error) {
+	file, err := os.Open(repository.Path)
+	if err != nil {
+		return "", fmt.Errorf("error reading dataset file [%s]: %w", repository.Path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading dataset file [%s]: %w", repository.Path, err)
+	}
+	return contentVersion(hash), nil
+}
+
+// Save replaces file with users written in its format. Users are written into a temporary file next to it,
+// which is renamed over the file, so readers see either old or new content.
+func (repository *FileRepository) Save(ctx context.Context, users []UserEntry) error {
+	if err := repository.save(ctx, users); err != nil {
+		return fmt.Errorf("error writing dataset file [%s]: %w", repository.Path, err)
+	}
+	return nil
+}
+
+func (repository *FileRepository) save(ctx context.Context, users []UserEntry) error {
+	file, err := os.CreateTemp(filepath.Dir(repository.Path), "."+filepath.Base(repository.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // nothing is left after rename
+	defer file.Close()
+	if info, err := os.Stat(repository.Path); err == nil {
+		if err := file.Chmod(info.Mode()); err != nil {
+			return err
+		}
+	}
+	if err := encodeUsers(file, repository.Format, users); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), repository.Path)
+}
+
+// Decode users one by one, loading stops at the first malformed or invalid row.
+func decodeUsers(r io.Reader, format string, maxRows int) ([]UserEntry, error) {
+	rows := newRowCollector(maxRows)
+	var err error
+	switch format {
+	case FormatJSON:
+		err = decodeJSONUsers(r, rows)
+	case FormatJSONL:
+		err = decodeJSONLUsers(r, rows)
+	case FormatCSV:
+		err = decodeCSVUsers(r, rows)
+	default:
+		err = decodeXMLUsers(r, rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows.result()
+}
+
+// Walk <row> elements of the root element with xml.Decoder.Token.
+func decodeXMLUsers(r io.Reader, rows *rowCollector) error {
+	decoder := xml.NewDecoder(r)
+	for depth := 0; ; {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			if depth != 1 || element.Name.Local != "row" {
+				depth++
+				continue
+			}
+			if err := rows.reserve(); err != nil {
+				return err
+			}
+			line, _ := decoder.InputPos()
+			var entry UserEntry
+			if err := decoder.DecodeElement(&entry, &element); err != nil {
+				return rows.rowError(line, err)
+			}
+			if err := rows.add(&entry, line); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// Walk elements of the top level array, decoder doesn't report lines.
+func decodeJSONUsers(r io.Reader, rows *rowCollector) error {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return errors.New("array of users expected")
+	}
+	for decoder.More() {
+		if err := rows.reserve(); err != nil {
+			return err
+		}
+		var entry UserEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return rows.rowError(0, err)
+		}
+		if err := rows.add(&entry, 0); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Blank lines are skipped.
+func decodeJSONLUsers(r io.Reader, rows *rowCollector) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(bytes.TrimSpace(content)) > 0 {
+			if err := rows.reserve(); err != nil {
+				return err
+			}
+			var entry UserEntry
+			if err := json.Unmarshal(content, &entry); err != nil {
+				return rows.rowError(line, err)
+			}
+			if err := rows.add(&entry, line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Columns are matched by header names, unknown columns are ignored and missing ones are zero.
+func decodeCSVUsers(r io.Reader, rows *rowCollector) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("header row expected: %w", err)
+	}
+	header = slices.Clone(header)      // record is reused by the next read
+	fields := make([]int, len(header)) // index of UserEntry field by column, -1 if unknown
+	for i, name := range header {
+		fields[i] = slices.Index(entryColumns, strings.TrimSpace(name))
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err := rows.reserve(); err != nil {
+			return err
+		}
+		if err != nil {
+			return rows.rowError(0, err) // csv.ParseError has a line
+		}
+		line, _ := reader.FieldPos(0)
+		var entry UserEntry
+		for i, value := range record {
+			if fields[i] < 0 {
+				continue
+			}
+			if err := setColumn(&entry, fields[i], value); err != nil {
+				return rows.rowError(line, fmt.Errorf("column %s: %w", header[i], err))
+			}
+		}
+		if err := rows.add(&entry, line); err != nil {
+			return err
+		}
+	}
+}
+
+// Columns of csv and sql datasets in order of UserEntry fields, named as elements of dataset.xml.
+var entryColumns = func() []string {
+	entryType := reflect.TypeOf(UserEntry{})
+	columns := make([]string, entryType.NumField())
+	for i := range columns {
+		columns[i] = entryType.Field(i).Tag.Get("xml")
+	}
+	return columns
+}()
+
+func setColumn(entry *UserEntry, field int, value string) error {
+	target := reflect.ValueOf(entry).Elem().Field(field)
+	if unmarshaler, ok := target.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+	if target.Kind() == reflect.String {
+		target.SetString(value)
+		return nil
+	}
+	if value = strings.TrimSpace(value); value == "" {
+		return nil
+	}
+	if target.Kind() == reflect.Bool {
+		parsed, err := strconv.ParseBool(value)
+		target.SetBool(parsed)
+		return err
+	}
+	parsed, err := strconv.Atoi(value)
+	target.SetInt(int64(parsed))
+	return err
+}
+
+func getColumn(entry *UserEntry, field int) (string, error) {
+	source := reflect.ValueOf(entry).Elem().Field(field)
+	if marshaler, ok := source.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	return fmt.Sprint(source.Interface()), nil
+}
+
+// Write users in one of Format* formats, decodeUsers reads them back as they are.
+func encodeUsers(w io.Writer, format string, users []UserEntry) error {
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(users)
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		for i := range users {
+			if err := encoder.Encode(&users[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(entryColumns); err != nil {
+			return err
+		}
+		record := make([]string, len(entryColumns))
+		for i := range users {
+			for field := range entryColumns {
+				var err error
+				if record[field], err = getColumn(&users[i], field); err != nil {
+					return err
+				}
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case FormatXML:
+		return encodeXMLUsers(w, users)
+	default:
+		return fmt.Errorf("unknown dataset format %q", format)
+	}
+}
+
+// Written as dataset.xml is: element per line, text is escaped keeping line breaks to stay editable by hand.
+func encodeXMLUsers(w io.Writer, users []UserEntry) error {
+	writer := bufio.NewWriter(w)
+	writer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" ?>\n<root>\n")
+	for i := range users {
+		writer.WriteString("  <row>\n")
+		for field, column := range entryColumns {
+			value, err := getColumn(&users[i], field)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(writer, "    <%s>%s</%s>\n", column, xmlTextEscaper.Replace(value), column)
+		}
+		writer.WriteString("  </row>\n")
+	}
+	writer.WriteString("</root>\n")
+	return writer.Flush()
+}
+
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
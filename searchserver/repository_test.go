@@ -0,0 +1,248 @@
+package searchserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRow = "  <row>\n    <id>%d</id>\n    <age>20</age>\n    <first_name>User</first_name>\n    <gender>male</gender>\n  </row>\n"
+
+// endlessRows is a dataset document which never ends: a loader reading the whole document first never returns.
+type endlessRows struct {
+	next    int
+	pending string
+}
+
+func (r *endlessRows) Read(p []byte) (int, error) {
+	if r.pending == "" {
+		if r.next == 0 {
+			r.pending = "<root>\n"
+		}
+		r.pending += fmt.Sprintf(testRow, r.next)
+		r.next++
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestDecodeXMLUsers(t *testing.T) {
+	rows := func(ids ...int) string {
+		var document strings.Builder
+		document.WriteString("<?xml version=\"1.0\"?>\n<root>\n")
+		for _, id := range ids {
+			fmt.Fprintf(&document, testRow, id)
+		}
+		return document.String() + "</root>\n"
+	}
+	cases := []struct {
+		document string
+		users    int
+		err      string
+		line     int
+	}{
+		{document: rows(0, 1, 2), users: 3},
+		{document: "<root><meta><row><id>5</id></row></meta><row><id>1</id><gender>female</gender></row></root>", users: 1},
+		{document: rows(0, 1, 1), err: "row 3 ( line 15 ): duplicate id 1", line: 15},
+		{document: rows(0, -1), err: "row 2 ( line 9 ): negative id -1", line: 9},
+		{document: strings.Replace(rows(0, 1), "<age>20</age>", "<age>old</age>", 1), err: "row 1 ( line 3 ): strconv.ParseInt", line: 3},
+		{document: strings.Replace(rows(0, 1), "<gender>male", "<gender>cat", 1), err: `row 1 ( line 3 ): invalid gender "cat"`, line: 3},
+		{document: strings.Replace(rows(0, 1), "</first_name>", "</last_name>", 1), err: "XML syntax error on line 6", line: 3},
+		{document: strings.TrimSuffix(rows(0, 1), "</root>\n"), err: "XML syntax error on line 15: unexpected EOF"},
+		{document: rows(), err: "no users found"},
+		{document: rows(0, 1, 2, 3), err: "more than 3 rows"},
+	}
+	for caseNum, item := range cases {
+		members, err := decodeUsers(strings.NewReader(item.document), FormatXML, 3)
+		if item.err == "" {
+			if err != nil || len(members) != item.users {
+				t.Errorf("[%d] expected %d users, got %d ( %v )", caseNum, item.users, len(members), err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), item.err) {
+			t.Errorf("[%d] expected error containing %q, got %v", caseNum, item.err, err)
+		}
+		var rowErr *RowError
+		if item.line != 0 && (!errors.As(err, &rowErr) || rowErr.Line != item.line) {
+			t.Errorf("[%d] expected row error on line %d, got %#v", caseNum, item.line, err)
+		}
+	}
+}
+
+func TestDecodeUsersStreaming(t *testing.T) {
+	// rows are decoded as they are read, so the limit stops an endless document
+	_, err := decodeUsers(&endlessRows{}, FormatXML, 1000)
+	if err == nil || err.Error() != "more than 1000 rows" {
+		t.Errorf("expected max rows error, got %v", err)
+	}
+	_, err = decodeUsers(io.LimitReader(&endlessRows{}, 1<<20), FormatXML, 0)
+	if err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Errorf("expected truncated document error, got %v", err)
+	}
+}
+
+// Registered times are compared as instants: location of parsed time depends on local zone.
+func sameEntries(t *testing.T, expected, got []UserEntry) {
+	t.Helper()
+	if len(expected) != len(got) {
+		t.Fatalf("expected %d users, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		want, have := expected[i], got[i]
+		if !want.Registered.Time.Equal(have.Registered.Time) {
+			t.Errorf("[%d] expected registered %s, got %s", i, want.Registered.Time, have.Registered.Time)
+		}
+		want.Registered, have.Registered = registeredTime{}, registeredTime{}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("[%d] expected %#v, got %#v", i, want, have)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []string{FormatXML, FormatJSON, FormatJSONL, FormatCSV} {
+		path := filepath.Join(dir, "dataset."+format)
+		var content bytes.Buffer
+		if err := encodeUsers(&content, format, testData.members); err != nil {
+			t.Fatalf("%s: unexpected error: %s", format, err)
+		}
+		if err := os.WriteFile(path, content.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		repository, err := NewFileRepository(path, "")
+		if err != nil || repository.Format != format {
+			t.Fatalf("%s: expected format by extension, got %v ( %v )", format, repository, err)
+		}
+		members, err := repository.Users(0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", format, err)
+		}
+		sameEntries(t, testData.members, members)
+		// the same search over every format
+		server, err := New(Config{DatasetPath: path, Tokens: []string{"token"}})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", format, err)
+		}
+		if names := searchNames(t, server, "Boyd"); names != `[{"Name":"Boyd Wolf"}]` {
+			t.Errorf("%s: expected Boyd Wolf, got %v", format, names)
+		}
+	}
+}
+
+func TestFileRepository(t *testing.T) {
+	dir := t.TempDir()
+	for path, format := range map[string]string{"users.XML": FormatXML, "users.ndjson": FormatJSONL, "users.jsonl": FormatJSONL} {
+		if repository, err := NewFileRepository(path, ""); err != nil || repository.Format != format {
+			t.Errorf("%s: expected format %s, got %v ( %v )", path, format, repository, err)
+		}
+	}
+	if repository, err := NewFileRepository("users.txt", FormatCSV); err != nil || repository.Format != FormatCSV {
+		t.Errorf("expected format of flag to win over extension, got %v ( %v )", repository, err)
+	}
+	for _, item := range [][2]string{{"users.txt", ""}, {"users", ""}, {"users.xml", "yaml"}} {
+		if _, err := NewFileRepository(item[0], item[1]); err == nil || !strings.Contains(err.Error(), "unknown dataset format") {
+			t.Errorf("%v: expected unknown format error, got %v", item, err)
+		}
+	}
+	missing := &FileRepository{Path: filepath.Join(dir, "missing.json"), Format: FormatJSON}
+	if _, err := missing.Users(0); err == nil || !strings.Contains(err.Error(), "error reading dataset file") {
+		t.Errorf("expected read error, got %v", err)
+	}
+	if _, err := missing.Version(); err == nil || !strings.Contains(err.Error(), "error reading dataset file") {
+		t.Errorf("expected read error, got %v", err)
+	}
+	version, err := (&FileRepository{Path: testDatasetPath, Format: FormatXML}).Version()
+	if err != nil || version != testData.version || len(version) != 16 {
+		t.Errorf("expected version %s, got %s ( %v )", testData.version, version, err)
+	}
+
+	// version of load is the hash of whole file, including what follows the last row
+	repository := &FileRepository{Path: filepath.Join(dir, "users.xml"), Format: FormatXML}
+	versions := map[string]bool{}
+	for _, tail := range []string{"", "\n<!-- end -->\n"} {
+		if err := os.WriteFile(repository.Path, []byte("<root>"+reloadTestUser+"</root>"+tail), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		members, loaded, err := repository.load(0)
+		version, _ := repository.Version()
+		if err != nil || len(members) != 1 || loaded != version {
+			t.Errorf("%q: expected 1 user of version %s, got %d users of version %s ( %v )", tail, version, len(members), loaded, err)
+		}
+		versions[loaded] = true
+	}
+	if len(versions) != 2 {
+		t.Errorf("expected tail to change version, got %v", versions)
+	}
+}
+
+// Repository without contentLoader.
+type countingRepository struct {
+	UserRepository
+	reads int
+}
+
+func (repository *countingRepository) Users(maxRows int) ([]UserEntry, error) {
+	repository.reads++
+	return repository.UserRepository.Users(maxRows)
+}
+
+func TestLoadDataset(t *testing.T) {
+	repository := &countingRepository{UserRepository: newTestSQLRepository(t, testData.members)}
+	data, err := loadDataset(repository, 0, "")
+	if err != nil || len(data.members) != len(testData.members) || repository.reads != 1 {
+		t.Fatalf("expected dataset read once, got %d reads ( %v )", repository.reads, err)
+	}
+	if unchanged, err := loadDataset(repository, 0, data.version); err != nil || unchanged != nil || repository.reads != 1 {
+		t.Errorf("expected users of current version not to be read, got %d reads ( %v )", repository.reads, err)
+	}
+}
+
+func TestDecodeUsers(t *testing.T) {
+	cases := []struct {
+		format   string
+		document string
+		users    int
+		err      string
+	}{
+		{format: FormatJSON, document: `[{"id": 1, "gender": "male", "balance": 10.5, "registered": "2017-02-05T06:23:27-03:00"}]`, users: 1},
+		{format: FormatJSON, document: `{"id": 1}`, err: "array of users expected"},
+		{format: FormatJSON, document: `[{"id": 1, "gender": "male"}, {"id": "2"}]`, err: "row 2: json: cannot unmarshal string"},
+		{format: FormatJSON, document: `[{"id": 1, "gender": "male"}, {"id": 1, "gender": "male"}]`, err: "row 2: duplicate id 1"},
+		{format: FormatJSON, document: `[{"id": 1, "gender": "male"}`, err: "unexpected end of JSON input"},
+		{format: FormatJSON, document: `[]`, err: "no users found"},
+		{format: FormatJSONL, document: "{\"id\": 1, \"gender\": \"male\"}\n\n{\"id\": 2, \"gender\": \"female\"}", users: 2},
+		{format: FormatJSONL, document: "{\"id\": 1, \"gender\": \"male\"}\n\n{\"id\": 2, \"gender\": \"cat\"}\n", err: `row 2 ( line 3 ): invalid gender "cat"`},
+		{format: FormatJSONL, document: "{\"id\": 1, \"gender\": \"male\"}\n{\"id\": 2,\n", err: "row 2 ( line 2 ): unexpected end of JSON input"},
+		{format: FormatJSONL, document: "{\"id\": 1, \"gender\": \"male\"}\n{\"id\": 2, \"gender\": \"male\"}\n{\"id\": 3}\n", err: "more than 2 rows"},
+		{format: FormatCSV, document: "id,gender,nickname\n1,male,bob\n2,female,\n", users: 2},
+		{format: FormatCSV, document: "id,gender,age\n1,male,\n2,female,old\n", err: "row 2 ( line 3 ): column age: strconv.Atoi"},
+		{format: FormatCSV, document: "id,gender,isActive\n1,male,maybe\n", err: "row 1 ( line 2 ): column isActive: strconv.ParseBool"},
+		{format: FormatCSV, document: "id,gender,balance\n1,male,$1.005\n", err: `row 1 ( line 2 ): column balance: invalid amount "$1.005"`},
+		{format: FormatCSV, document: "id,gender\n1,male\n2\n", err: "row 2: record on line 3: wrong number of fields"},
+		{format: FormatCSV, document: "", err: "header row expected: EOF"},
+	}
+	for caseNum, item := range cases {
+		members, err := decodeUsers(strings.NewReader(item.document), item.format, 2)
+		if item.err == "" {
+			if err != nil || len(members) != item.users {
+				t.Errorf("[%d] expected %d users, got %d ( %v )", caseNum, item.users, len(members), err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), item.err) {
+			t.Errorf("[%d] expected error containing %q, got %v", caseNum, item.err, err)
+		}
+	}
+	if err := encodeUsers(io.Discard, "yaml", testData.members); err == nil {
+		t.Errorf("expected unknown format error")
+	}
+}
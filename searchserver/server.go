@@ -0,0 +1,419 @@
+// Package searchserver is the external system SearchClient talks to: it searches users of dataset.xml.
+package searchserver
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	accessTokenHeader  = "AccessToken"
+	defaultDatasetPath = "dataset.xml"
+	defaultMaxLimit    = 100
+)
+
+var InternalServerErrorContent []byte = []byte("{\"status\": 500, \"reason\": \"Internal Server Error\"}")
+
+type Config struct {
+	DatasetPath       string         // dataset.xml if empty
+	DatasetFormat     string         // one of Format*, by extension of DatasetPath if empty
+	Repository        UserRepository // instead of dataset file ( e.g. SQLRepository )
+	Tokens            []string       // accepted values of AccessToken header, can search and read full records
+	RegexMatchTimeout time.Duration  // 200ms if 0
+	MaxLimit          int            // max users per page, 100 if 0
+	AdminTokens       []string       // accepted values of AccessToken header for /admin/ endpoints and changes of users
+	TokenStore        *TokenStore    // tokens with scopes instead of Tokens and AdminTokens ( see LoadTokenStore )
+	JWT               *JWTVerifier   // accepts signed tokens of Authorization: Bearer header if set
+	TokenRateLimit    RateLimit      // requests of every token ( by name ), no limit if zero
+	IPRateLimit       RateLimit      // requests of every client IP including unauthorized ones, no limit if zero
+	ReloadInterval    time.Duration  // how often Watch checks dataset file, Watch does nothing if 0
+	Logger            *log.Logger    // log.Default() if nil
+	MaxRows           int            // max users in dataset file, unlimited if 0
+}
+
+// Server is an http.Handler serving search ( any path ), name suggestions ( /suggest ), users ( /users )
+// and dataset administration ( /admin/ ).
+type Server struct {
+	config     Config
+	repository UserRepository
+	tokens     *TokenStore
+	data       atomic.Pointer[dataset] // swapped by reload, every request uses the dataset it started with
+
+	tokenLimiter *rateLimiter // nil if off
+	ipLimiter    *rateLimiter
+
+	reloadMu    sync.Mutex // one reload at a time
+	seenModTime time.Time  // of dataset file on the last reload
+	seenSize    int64
+	errMu       sync.Mutex
+	reloadErr   error // of the last reload
+}
+
+// New loads dataset and builds search indexes. Error is returned if dataset can't be read or parsed.
+func New(config Config) (*Server, error) {
+	if config.DatasetPath == "" {
+		config.DatasetPath = defaultDatasetPath
+	}
+	if config.RegexMatchTimeout == 0 {
+		config.RegexMatchTimeout = defaultRegexMatchTimeout
+	}
+	if config.MaxLimit == 0 {
+		config.MaxLimit = defaultMaxLimit
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	server := &Server{config: config, repository: config.Repository, tokens: config.TokenStore,
+		tokenLimiter: newRateLimiter(config.TokenRateLimit), ipLimiter: newRateLimiter(config.IPRateLimit)}
+	if server.tokens == nil {
+		server.tokens = legacyTokenStore(config.Tokens, config.AdminTokens)
+	}
+	if server.repository == nil {
+		repository, err := NewFileRepository(config.DatasetPath, config.DatasetFormat)
+		if err != nil {
+			return nil, err
+		}
+		server.repository = repository
+	}
+	if _, err := server.fileChanged(); err != nil {
+		return nil, err
+	}
+	data, err := loadDataset(server.repository, config.MaxRows, "")
+	if err != nil {
+		return nil, err
+	}
+	data.modTime = server.seenModTime
+	server.data.Store(data)
+	return server, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer recoverInternalError(w)
+	data := s.data.Load()
+	if !s.ipLimiter.allow(w, clientIP(r)) {
+		return
+	}
+	// 1. authorize request.
+	token, authorized := s.authorize(r)
+	if !authorized {
+		handleErrorResponse(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	noteTokenName(r, token.Name)
+	if !s.tokenLimiter.allow(w, token.Name) { // headers of token bucket replace headers of IP bucket
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		if permit(w, token, ScopeAdmin) {
+			s.admin(w, r)
+		}
+		return
+	}
+	if r.URL.Path == usersPath || strings.HasPrefix(r.URL.Path, usersPath+"/") {
+		s.users(data, token, w, r)
+		return
+	}
+	if !permit(w, token, ScopeSearch) {
+		return
+	}
+	if r.URL.Path == "/suggest" {
+		s.suggest(data, w, r)
+		return
+	}
+	// 2. validate search params.
+	searchParams, err := validateSearchParams(r, s.config.MaxLimit)
+	if err != nil {
+		handleBadRequest(w, err)
+		return
+	}
+	if searchParams.ResponseVersion == ResponseVersionDetails && !permit(w, token, ScopeReadPII) {
+		return
+	}
+	if searcher, ok := s.repository.(userSearcher); ok && searchableInSQL(searchParams) {
+		s.searchRepository(searcher, searchParams, w, r)
+		return
+	}
+	query, err := data.compileQuery(searchParams, s.config.RegexMatchTimeout)
+	if err != nil {
+		handleBadRequest(w, err)
+		return
+	}
+	// 3. search data -> handle errrors -> prodive response result.
+	data.search(searchParams, query, w)
+}
+
+// Recover responds with 500 when next handler panics.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer recoverInternalError(w)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func recoverInternalError(w http.ResponseWriter) {
+	if r := recover(); r != nil {
+		handleErrorResponse(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func produceErrorResponse(reason string) SearchErrorResponse {
+	return SearchErrorResponse{Error: reason}
+}
+
+func (e SearchErrorResponse) Msg() []byte {
+	if msg, err := json.Marshal(e); err != nil {
+		return InternalServerErrorContent
+	} else {
+		return msg
+	}
+}
+
+// Bad request error, which carries detail for client ( e.g. unknown field name ).
+type badRequestError struct {
+	reason string
+	detail string
+	pos    int
+}
+
+func (e *badRequestError) Error() string {
+	return e.reason
+}
+
+// Bearer token is checked instead of AccessToken header when it is sent.
+func (s *Server) authorize(r *http.Request) (token *Token, isAuthorized bool) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if s.config.JWT == nil {
+			return nil, false
+		}
+		token, err := s.config.JWT.Verify(strings.TrimSpace(bearer), time.Now())
+		return token, err == nil
+	}
+	return s.tokens.Lookup(r.Header.Get(accessTokenHeader), time.Now())
+}
+
+func handleErrorResponse(w http.ResponseWriter, status int, reason string) {
+	writeErrorResponse(w, status, produceErrorResponse(reason))
+}
+
+// Respond with 400. Detail of error is passed to client when known.
+func handleBadRequest(w http.ResponseWriter, err error) {
+	errResp := produceErrorResponse(err.Error())
+	var badRequest *badRequestError
+	if errors.As(err, &badRequest) {
+		errResp.Detail = badRequest.detail
+		errResp.Pos = badRequest.pos
+	}
+	writeErrorResponse(w, http.StatusBadRequest, errResp)
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, errResp SearchErrorResponse) {
+	w.WriteHeader(status)
+	if _, err := w.Write(errResp.Msg()); err != nil {
+		panic("error to response")
+	}
+}
+
+// Build sort function based on order_field and order_by from search params.
+func resolveSortFunc(slice []User, searchParams *SearchRequest) func(i, j int) bool {
+	switch searchParams.OrderField {
+	default:
+		return func(i, j int) bool { return cmp.Compare(slice[i].Name, slice[j].Name) == searchParams.OrderBy }
+	case ageField:
+		return func(i, j int) bool { return cmp.Compare(slice[i].Age, slice[j].Age) == searchParams.OrderBy }
+	case idField:
+		return func(i, j int) bool { return cmp.Compare(slice[i].Id, slice[j].Id) == searchParams.OrderBy }
+	}
+}
+
+func sortUsersBeforeSearch(searchParams *SearchRequest, users []User) {
+	if searchParams.OrderBy == OrderByAsIs {
+		return
+	}
+	sort.Slice(users, resolveSortFunc(users, searchParams))
+}
+
+// Filters predicate. Zero values of filters are not applied.
+func matchesFilters(user *User, filters *Filters) bool {
+	if filters.AgeMin != 0 && user.Age < filters.AgeMin {
+		return false
+	}
+	if filters.AgeMax != 0 && user.Age > filters.AgeMax {
+		return false
+	}
+	if filters.Gender != "" && user.Gender != filters.Gender {
+		return false
+	}
+	return len(filters.Ids) == 0 || slices.Contains(filters.Ids, user.Id)
+}
+
+// Compile query accordingly to query_mode. Plain substring query is a single term in any field.
+// Terms are normalized accordingly to match_mode.
+func (data *dataset) compileQuery(searchParams *SearchRequest, regexTimeout time.Duration) (queryNode, error) {
+	if searchParams.Fuzziness > 0 {
+		tokens := tokenizeName(searchParams.Query)
+		if len(tokens) == 0 {
+			return &fuzzyNode{}, nil
+		}
+		return &fuzzyNode{
+			query:     &fuzzyQuery{tokens: tokens, maxDistance: searchParams.Fuzziness},
+			distances: data.fuzzy.match(tokens, searchParams.Fuzziness),
+		}, nil
+	}
+	switch searchParams.QueryMode {
+	case QueryModeRegex:
+		re, err := compileRegex(searchParams.Query, searchParams.MatchMode)
+		if err != nil {
+			return nil, err
+		}
+		return &regexNode{re: re, deadline: time.Now().Add(regexTimeout)}, nil
+	case QueryModeBoolean:
+	default:
+		return &termNode{text: normalizer(searchParams.MatchMode)(searchParams.Query)}, nil
+	}
+	query, err := parseQuery(searchParams.Query)
+	var syntaxErr *querySyntaxError
+	if errors.As(err, &syntaxErr) {
+		return nil, &badRequestError{reason: ErrorBadQuery, detail: syntaxErr.msg, pos: syntaxErr.pos}
+	}
+	if err != nil {
+		return nil, err
+	}
+	mapTerms(query, normalizer(searchParams.MatchMode))
+	return query, nil
+}
+
+// Search predicate. Query and filters are combined with AND.
+func matches(user *User, doc *searchDoc, query queryNode, filters *Filters) bool {
+	return matchesFilters(user, filters) && query.eval(doc)
+}
+
+func userFieldValue(user *User, field string) interface{} {
+	switch field {
+	case idField:
+		return user.Id
+	case nameField:
+		return user.Name
+	case ageField:
+		return user.Age
+	case aboutField:
+		return user.About
+	default:
+		return user.Gender
+	}
+}
+
+// Response with extras ( highlights, scores ), which are aligned with users, facets over all matched users
+// and spelling suggestions.
+type searchEnvelope struct {
+	Users       json.RawMessage
+	Highlights  []Highlight `json:",omitempty"`
+	Scores      []float64   `json:",omitempty"`
+	Facets      []Facet     `json:",omitempty"`
+	Suggestions []string    `json:"suggestions,omitempty"`
+}
+
+// Skip offset users and keep not more than limit of the rest. Offset past the end gives empty page.
+func paginate(users []User, offset, limit int) []User {
+	if offset >= len(users) {
+		return []User{}
+	}
+	return users[offset:min(offset+limit, len(users))]
+}
+
+// Serialize users keeping only requested fields.
+// Fields are expected to be validated and ordered already ( see parseFields ).
+func marshalUsers(users []User, fields []string) ([]byte, error) {
+	return marshalFields(users, fields, userFieldValue)
+}
+
+func marshalFields[T any](records []T, fields []string, fieldValue func(*T, string) interface{}) ([]byte, error) {
+	if len(fields) == 0 {
+		return json.Marshal(records)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := range records {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		for j, field := range fields {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			value, err := json.Marshal(fieldValue(&records[i], field))
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(strconv.Quote(field))
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+func (data *dataset) search(searchParams *SearchRequest, query queryNode, w http.ResponseWriter) {
+	searchResult := data.index.find(query, searchParams, false) // result is a copy, original sequence is kept between requests
+	if re, ok := query.(*regexNode); ok && re.timedOut {
+		handleErrorResponse(w, http.StatusServiceUnavailable, RegexTimeoutError.Error())
+		return
+	}
+	var suggestions []string // did you mean
+	if searchParams.SuggestDistance > 0 && len(searchResult) <= maxSuggestHits {
+		suggestions = data.spellingSuggestions(searchParams, len(searchResult))
+	}
+	var scores map[int]float64 // by user id
+	if searchParams.OrderField == relevanceField {
+		terms := relevanceTerms(query)
+		scores = make(map[int]float64, len(searchResult))
+		for i := range searchResult {
+			scores[searchResult[i].Id] = data.bm25.score(searchResult[i].Id, terms, searchParams.Boosts)
+		}
+		sortByRelevance(searchParams, searchResult, scores)
+	} else {
+		sortUsersBeforeSearch(searchParams, searchResult) // sort result if needed accordingly to search params
+	}
+	// fuzzy search: closest matches first, search params order is kept for ties
+	if fuzzy, ok := query.(*fuzzyNode); ok && fuzzy.query != nil {
+		sort.SliceStable(searchResult, func(i, j int) bool {
+			return fuzzy.distances[searchResult[i].Id] < fuzzy.distances[searchResult[j].Id]
+		})
+	}
+	page := paginate(searchResult, searchParams.Offset, searchParams.Limit)
+	response, err := data.marshalPage(page, searchParams)
+	if err == nil && (searchParams.Highlight != nil || scores != nil || searchParams.Facets != nil || suggestions != nil) {
+		envelope := searchEnvelope{Users: response, Facets: computeFacets(searchParams.Facets, searchResult), Suggestions: suggestions}
+		for i := range page {
+			if searchParams.Highlight != nil {
+				envelope.Highlights = append(envelope.Highlights, highlightUser(&page[i], query, searchParams))
+			}
+			if scores != nil {
+				envelope.Scores = append(envelope.Scores, scores[page[i].Id])
+			}
+		}
+		response, err = json.Marshal(envelope)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	n, err := w.Write(response)
+	if n != len(response) || err != nil {
+		panic("failed to process response")
+	}
+}
@@ -0,0 +1,85 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDatasetPath = "../dataset.xml"
+
+var testData = mustLoadDataset(testDatasetPath)
+
+func mustLoadDataset(path string) *dataset {
+	data, err := loadDataset(&FileRepository{Path: path, Format: FormatXML}, 0, "")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	broken, empty := filepath.Join(dir, "broken.xml"), filepath.Join(dir, "empty.xml")
+	if err := os.WriteFile(broken, []byte("<root><row><id>1</id>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, []byte("<root></root>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path string
+		err  string
+	}{
+		{path: filepath.Join(dir, "missing.xml"), err: "error reading dataset file"},
+		{path: broken, err: "error parsing xml"},
+		{path: empty, err: "no users found"},
+	}
+	for caseNum, item := range cases {
+		if _, err := New(Config{DatasetPath: item.path}); err == nil || !strings.Contains(err.Error(), item.err) {
+			t.Errorf("[%d] expected error containing %q, got %v", caseNum, item.err, err)
+		}
+	}
+	server, err := New(Config{DatasetPath: testDatasetPath, Tokens: []string{"token"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(server.data.Load().members) != len(testData.members) || server.config.RegexMatchTimeout != defaultRegexMatchTimeout {
+		t.Errorf("expected dataset of %d users and default config, got %d users, %v", len(testData.members),
+			len(server.data.Load().members), server.config)
+	}
+}
+
+func TestPaging(t *testing.T) {
+	server, err := New(Config{DatasetPath: testDatasetPath, Tokens: []string{"token"}, MaxLimit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cases := []struct {
+		params   string
+		status   int
+		expected string
+	}{
+		{params: "limit=3&offset=0", status: http.StatusOK, expected: `[{"Id":0},{"Id":1},{"Id":2}]`},
+		{params: "limit=3&offset=3", status: http.StatusOK, expected: `[{"Id":3},{"Id":4},{"Id":5}]`},
+		{params: "limit=10&offset=32", status: http.StatusOK, expected: `[{"Id":32},{"Id":33},{"Id":34}]`}, // last page
+		{params: "limit=3&offset=35", status: http.StatusOK, expected: `[]`},
+		{params: "limit=3&offset=1000", status: http.StatusOK, expected: `[]`},
+		{params: "limit=0&offset=0", status: http.StatusOK, expected: `[]`},
+		{params: "limit=-1&offset=0", status: http.StatusBadRequest, expected: `{"Error":"limit must be between 0 and 10"}`},
+		{params: "limit=11&offset=0", status: http.StatusBadRequest, expected: `{"Error":"limit must be between 0 and 10"}`},
+		{params: "limit=3&offset=-3", status: http.StatusBadRequest, expected: `{"Error":"offset must not be negative"}`},
+	}
+	for caseNum, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/?order_by=-1&order_field=Id&fields=Id&"+item.params, nil)
+		r.Header.Set(accessTokenHeader, "token")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != item.status || w.Body.String() != item.expected {
+			t.Errorf("[%d] expected %d %s, got %d %s", caseNum, item.status, item.expected, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package searchserver
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxSuggestHits     = 2 // spelling suggestions are made when search finds not more users
+	maxSpellingVariant = 3
+	minSpellingLength  = 3 // shorter words are too ambiguous to correct
+)
+
+// Vocabulary of Name and About words for spelling suggestions. Words are folded ( see tokenizeWords ),
+// corrections are returned in the most common original spelling.
+type spellIndex struct {
+	tree     *bkTree
+	freqs    map[string]int    // word -> number of users having it
+	spelling map[string]string // word -> most common original spelling
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func buildSpellIndex(users []User) *spellIndex {
+	index := &spellIndex{freqs: make(map[string]int), spelling: make(map[string]string)}
+	spellings := make(map[string]map[string]int)
+	for i := range users {
+		seen := make(map[string]bool)
+		for _, word := range strings.FieldsFunc(users[i].Name+" "+users[i].About, func(r rune) bool { return !isWordRune(r) }) {
+			token := foldText(word, true)
+			if spellings[token] == nil {
+				spellings[token] = make(map[string]int)
+			}
+			spellings[token][word]++
+			if !seen[token] {
+				seen[token] = true
+				index.freqs[token]++
+			}
+		}
+	}
+	for token, variants := range spellings {
+		if index.tree == nil {
+			index.tree = &bkTree{term: token, children: map[int]*bkTree{}}
+		}
+		index.tree.add(token)
+		for word, count := range variants {
+			best := index.spelling[token]
+			if best == "" || count > variants[best] || count == variants[best] && word < best {
+				index.spelling[token] = word
+			}
+		}
+	}
+	return index
+}
+
+// Known words within maxDistance from word: closest first, then most frequent.
+func (index *spellIndex) corrections(word string, maxDistance int) []string {
+	type candidate struct {
+		token    string
+		distance int
+	}
+	found := []candidate{}
+	if index.tree != nil {
+		index.tree.search(word, maxDistance, func(token string, distance int) {
+			found = append(found, candidate{token: token, distance: distance})
+		})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		left, right := found[i], found[j]
+		if left.distance != right.distance {
+			return left.distance < right.distance
+		}
+		if index.freqs[left.token] != index.freqs[right.token] {
+			return index.freqs[left.token] > index.freqs[right.token]
+		}
+		return left.token < right.token
+	})
+	corrections := make([]string, 0, min(len(found), maxSpellingVariant))
+	for _, c := range found[:min(len(found), maxSpellingVariant)] {
+		corrections = append(corrections, index.spelling[c.token])
+	}
+	return corrections
+}
+
+type misspelling struct {
+	start, end  int // byte range of word in query
+	corrections []string
+}
+
+// Words of query unknown to vocabulary along with their corrections. Operators and field names
+// of boolean query are kept as is.
+func (index *spellIndex) misspellings(query string, queryMode string, maxDistance int) []misspelling {
+	found := []misspelling{}
+	for start := 0; start < len(query); {
+		wordStart := strings.IndexFunc(query[start:], isWordRune)
+		if wordStart < 0 {
+			break
+		}
+		wordStart += start
+		wordEnd := strings.IndexFunc(query[wordStart:], func(r rune) bool { return !isWordRune(r) })
+		if wordEnd < 0 {
+			wordEnd = len(query)
+		} else {
+			wordEnd += wordStart
+		}
+		word, token := query[wordStart:wordEnd], foldText(query[wordStart:wordEnd], true)
+		start = wordEnd
+		if queryMode == QueryModeBoolean && ((word == "AND" || word == "OR" || word == "NOT") || strings.HasPrefix(query[wordEnd:], ":")) {
+			continue
+		}
+		if _, known := index.freqs[token]; known || len([]rune(token)) < minSpellingLength {
+			continue
+		}
+		if corrections := index.corrections(token, maxDistance); len(corrections) > 0 {
+			found = append(found, misspelling{start: wordStart, end: wordEnd, corrections: corrections})
+		}
+	}
+	return found
+}
+
+// Query variants with misspelled words replaced: the first one takes the best correction of every word,
+// others try the next corrections of one word at a time.
+func spellingVariants(query string, found []misspelling) []string {
+	build := func(choice func(i int) string) string {
+		var variant strings.Builder
+		pos := 0
+		for i, m := range found {
+			variant.WriteString(query[pos:m.start])
+			variant.WriteString(choice(i))
+			pos = m.end
+		}
+		variant.WriteString(query[pos:])
+		return variant.String()
+	}
+	variants := []string{build(func(i int) string { return found[i].corrections[0] })}
+	for i := range found {
+		for _, correction := range found[i].corrections[1:] {
+			variants = append(variants, build(func(j int) string {
+				if j == i {
+					return correction
+				}
+				return found[j].corrections[0]
+			}))
+		}
+	}
+	return variants
+}
+
+// Alternative spellings of query, which find more users than hits. Empty if there is nothing better.
+func (data *dataset) spellingSuggestions(searchParams *SearchRequest, hits int) []string {
+	found := data.spell.misspellings(searchParams.Query, searchParams.QueryMode, searchParams.SuggestDistance)
+	if len(found) == 0 {
+		return nil
+	}
+	var suggestions []string
+	for _, variant := range spellingVariants(searchParams.Query, found) {
+		params := *searchParams
+		params.Query = variant
+		query, err := data.compileQuery(&params, defaultRegexMatchTimeout)
+		if err != nil {
+			continue
+		}
+		if len(data.index.find(query, &params, false)) > hits && !slices.Contains(suggestions, variant) {
+			suggestions = append(suggestions, variant)
+		}
+		if len(suggestions) == maxSpellingVariant {
+			break
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,28 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpellingSuggestions(t *testing.T) {
+	cases := []struct {
+		query     string
+		queryMode string
+		distance  int
+		expected  []string
+	}{
+		{query: "Boyd Wlf", distance: 1, expected: []string{"Boyd Wolf"}},
+		{query: "Boyd Wlf", distance: 0, expected: nil},
+		{query: "comodo", distance: 1, expected: []string{"commodo"}},
+		{query: "name:Boid AND NOT about:nullamco", queryMode: QueryModeBoolean, distance: 1, expected: []string{"name:Boyd AND NOT about:ullamco"}},
+		{query: "xyzzyq", distance: 2, expected: nil},
+		{query: "Boyd", distance: 2, expected: nil},
+	}
+	for caseNum, item := range cases {
+		searchParams := &SearchRequest{Query: item.query, QueryMode: item.queryMode, SuggestDistance: item.distance}
+		if got := testData.spellingSuggestions(searchParams, 0); !reflect.DeepEqual(item.expected, got) {
+			t.Errorf("[%d] expected suggestions %q, got %q", caseNum, item.expected, got)
+		}
+	}
+}
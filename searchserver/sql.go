@@ -0,0 +1,337 @@
+package searchserver
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQL is written for SQLite ( instr, || concatenation, ? placeholders ), other databases are not supported:
+// MySQL, for one, reads || as logical OR.
+const sqlName = "first_name || ' ' || last_name"
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLRepository keeps users in a table with columns named as elements of dataset.xml ( see Migrate ).
+// Balance and registered time are stored as text in dataset format to keep them exact.
+type SQLRepository struct {
+	DB    *sql.DB
+	Table string
+}
+
+func NewSQLRepository(db *sql.DB, table string) (*SQLRepository, error) {
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &SQLRepository{DB: db, Table: table}, nil
+}
+
+// Migrate creates users table if it doesn't exist.
+func (repository *SQLRepository) Migrate(ctx context.Context) error {
+	entryType := reflect.TypeOf(UserEntry{})
+	columns := make([]string, len(entryColumns))
+	for i, column := range entryColumns {
+		switch field := entryType.Field(i); {
+		case column == "id":
+			columns[i] = column + " INTEGER PRIMARY KEY"
+		case field.Type.Kind() == reflect.Int:
+			columns[i] = column + " INTEGER NOT NULL DEFAULT 0"
+		case field.Type.Kind() == reflect.Bool:
+			columns[i] = column + " BOOLEAN NOT NULL DEFAULT FALSE"
+		default:
+			columns[i] = column + " TEXT NOT NULL DEFAULT ''"
+		}
+	}
+	_, err := repository.DB.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", repository.Table, strings.Join(columns, ", ")))
+	return err
+}
+
+// Save replaces users of the table in one transaction.
+func (repository *SQLRepository) Save(ctx context.Context, users []UserEntry) error {
+	tx, err := repository.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+repository.Table); err != nil {
+		return err
+	}
+	insert, err := tx.PrepareContext(ctx, repository.insertUser())
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for i := range users {
+		values, err := columnValues(&users[i])
+		if err != nil {
+			return err
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Create inserts user, other rows are left as they are. It fails with UserExistsError if id is taken, other
+// constraint failures are returned as they are.
+func (repository *SQLRepository) Create(ctx context.Context, entry UserEntry) error {
+	values, err := columnValues(&entry)
+	if err != nil {
+		return err
+	}
+	_, err = repository.DB.ExecContext(ctx, repository.insertUser(), values...)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY { // id is the primary key
+		return UserExistsError
+	}
+	return err
+}
+
+// Update replaces columns of user by id. It fails with UserNotFoundError if there is no such user.
+func (repository *SQLRepository) Update(ctx context.Context, entry UserEntry) error {
+	values, err := columnValues(&entry)
+	if err != nil {
+		return err
+	}
+	columns := make([]string, len(entryColumns))
+	for i, column := range entryColumns {
+		columns[i] = column + " = ?"
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", repository.Table, strings.Join(columns, ", "))
+	return expectRow(repository.DB.ExecContext(ctx, query, append(values, entry.Id)...))(UserNotFoundError)
+}
+
+// Delete deletes user by id. It fails with UserNotFoundError if there is no such user.
+func (repository *SQLRepository) Delete(ctx context.Context, id int) error {
+	return expectRow(repository.DB.ExecContext(ctx, "DELETE FROM "+repository.Table+" WHERE id = ?", id))(UserNotFoundError)
+}
+
+// INSERT of every column.
+func (repository *SQLRepository) insertUser() string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(entryColumns)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", repository.Table, strings.Join(entryColumns, ", "), placeholders)
+}
+
+// Result of statement which must change one row, otherwise it fails with noRow error.
+func expectRow(result sql.Result, err error) func(noRow error) error {
+	return func(noRow error) error {
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return cmp.Or(err, noRow)
+		}
+		return nil
+	}
+}
+
+// Values of entry in order of entryColumns: numbers and booleans as they are, other fields as text.
+func columnValues(entry *UserEntry) ([]interface{}, error) {
+	values := make([]interface{}, len(entryColumns))
+	for field := range entryColumns {
+		source := reflect.ValueOf(entry).Elem().Field(field)
+		if source.Kind() == reflect.Int || source.Kind() == reflect.Bool {
+			values[field] = source.Interface()
+			continue
+		}
+		var err error
+		if values[field], err = getColumn(entry, field); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Call fn with text of columns of every selected row.
+func (repository *SQLRepository) query(ctx context.Context, fn func(values []string) error, query string, args ...interface{}) error {
+	rows, err := repository.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	raw := make([]sql.RawBytes, len(entryColumns))
+	targets, values := make([]interface{}, len(raw)), make([]string, len(raw))
+	for i := range raw {
+		targets[i] = &raw[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		for i := range raw {
+			values[i] = string(raw[i]) // NULL is empty, which is zero value of any column
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (repository *SQLRepository) selectUsers() string {
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(entryColumns, ", "), repository.Table)
+}
+
+// Users are read in order of id.
+func (repository *SQLRepository) Users(maxRows int) ([]UserEntry, error) {
+	rows := newRowCollector(maxRows)
+	err := repository.query(context.Background(), func(values []string) error {
+		if err := rows.reserve(); err != nil {
+			return err
+		}
+		var entry UserEntry
+		if err := scanEntry(&entry, values); err != nil {
+			return rows.rowError(0, err)
+		}
+		return rows.add(&entry, 0)
+	}, repository.selectUsers()+" ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error reading table [%s]: %w", repository.Table, err)
+	}
+	return rows.result()
+}
+
+// Version is a hash of table content, it is read without building users.
+func (repository *SQLRepository) Version() (string, error) {
+	hash := sha256.New()
+	err := repository.query(context.Background(), func(values []string) error {
+		for _, value := range values {
+			fmt.Fprintf(hash, "%d:%s", len(value), value)
+		}
+		return nil
+	}, repository.selectUsers()+" ORDER BY id")
+	if err != nil {
+		return "", fmt.Errorf("error reading table [%s]: %w", repository.Table, err)
+	}
+	return contentVersion(hash), nil
+}
+
+func scanEntry(entry *UserEntry, values []string) error {
+	for field, value := range values {
+		if err := setColumn(entry, field, value); err != nil {
+			return fmt.Errorf("column %s: %w", entryColumns[field], err)
+		}
+	}
+	return nil
+}
+
+// Search runs search request in the table. Only requests accepted by searchableInSQL are supported.
+func (repository *SQLRepository) Search(ctx context.Context, searchParams *SearchRequest) ([]UserEntry, error) {
+	query, args := buildSearchSQL(repository.selectUsers(), searchParams)
+	users := []UserEntry{}
+	err := repository.query(ctx, func(values []string) error {
+		var entry UserEntry
+		if err := scanEntry(&entry, values); err != nil {
+			return err
+		}
+		users = append(users, entry)
+		return nil
+	}, query, args...)
+	return users, err
+}
+
+// Plain substring search with filters, order and paging can be answered by SQL. Anything else needs
+// indexes of loaded dataset.
+func searchableInSQL(searchParams *SearchRequest) bool {
+	return (searchParams.QueryMode == "" || searchParams.QueryMode == QueryModeSubstring) &&
+		(searchParams.MatchMode == "" || searchParams.MatchMode == MatchModeExact) &&
+		searchParams.Fuzziness == 0 && searchParams.OrderField != relevanceField && searchParams.Highlight == nil &&
+		len(searchParams.Facets) == 0 && searchParams.SuggestDistance == 0
+}
+
+// Translate search params into parameterized query. Values never become a part of SQL text.
+// Users of the same order value are ordered by id, as is order is the order of id.
+func buildSearchSQL(selectUsers string, searchParams *SearchRequest) (string, []interface{}) {
+	conditions, args := []string{}, []interface{}{}
+	if searchParams.Query != "" {
+		conditions = append(conditions, "(instr("+sqlName+", ?) > 0 OR instr(about, ?) > 0)")
+		args = append(args, searchParams.Query, searchParams.Query)
+	}
+	filters := &searchParams.Filters
+	if filters.AgeMin != 0 {
+		conditions, args = append(conditions, "age >= ?"), append(args, filters.AgeMin)
+	}
+	if filters.AgeMax != 0 {
+		conditions, args = append(conditions, "age <= ?"), append(args, filters.AgeMax)
+	}
+	if filters.Gender != "" {
+		conditions, args = append(conditions, "gender = ?"), append(args, filters.Gender)
+	}
+	if len(filters.Ids) > 0 {
+		conditions = append(conditions, "id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(filters.Ids)), ", ")+")")
+		for _, id := range filters.Ids {
+			args = append(args, id)
+		}
+	}
+	query := selectUsers
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if searchParams.OrderBy == OrderByAsIs {
+		query += " ORDER BY id"
+	} else {
+		column := sqlName
+		switch searchParams.OrderField {
+		case idField:
+			column = "id"
+		case ageField:
+			column = "age"
+		}
+		direction := "ASC"
+		if searchParams.OrderBy == OrderByDesc {
+			direction = "DESC"
+		}
+		query += fmt.Sprintf(" ORDER BY %s %s, id", column, direction)
+	}
+	return query + " LIMIT ? OFFSET ?", append(args, searchParams.Limit, searchParams.Offset)
+}
+
+// Repository which answers searches itself ( see SQLRepository.Search ).
+type userSearcher interface {
+	Search(ctx context.Context, searchParams *SearchRequest) ([]UserEntry, error)
+}
+
+func (s *Server) searchRepository(searcher userSearcher, searchParams *SearchRequest, w http.ResponseWriter, r *http.Request) {
+	users, err := searcher.Search(r.Context(), searchParams)
+	if err != nil {
+		s.config.Logger.Printf("repository search failed: %s", err)
+		handleErrorResponse(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	response, err := marshalEntries(users, searchParams)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(response); err != nil {
+		panic("failed to process response")
+	}
+}
+
+// Serialize users which are not a part of loaded dataset in requested response version.
+func marshalEntries(entries []UserEntry, searchParams *SearchRequest) ([]byte, error) {
+	if searchParams.ResponseVersion == ResponseVersionDetails {
+		details := make([]UserDetails, len(entries))
+		for i := range entries {
+			details[i] = entries[i].toUserDetails()
+		}
+		return marshalFields(details, searchParams.Fields, detailFieldValue)
+	}
+	users := make([]User, len(entries))
+	for i := range entries {
+		users[i] = entries[i].toUser()
+	}
+	return marshalUsers(users, searchParams.Fields)
+}
@@ -0,0 +1,206 @@
+package searchserver
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestSQLRepository(t *testing.T, members []UserEntry) *SQLRepository {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repository, err := NewSQLRepository(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Migrate(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := repository.Save(context.Background(), members); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return repository
+}
+
+func TestBuildSearchSQL(t *testing.T) {
+	injection := "x') OR 1=1; DROP TABLE users; --"
+	cases := []struct {
+		params SearchRequest
+		query  string
+		args   []interface{}
+	}{
+		{
+			params: SearchRequest{Limit: 10},
+			query:  "SELECT * FROM users ORDER BY id LIMIT ? OFFSET ?",
+			args:   []interface{}{10, 0},
+		},
+		{
+			params: SearchRequest{Limit: 5, Offset: 10, Query: injection, OrderField: ageField, OrderBy: OrderByDesc,
+				Filters: Filters{AgeMin: 20, AgeMax: 30, Gender: femaleGender, Ids: []int{1, 2}}},
+			query: "SELECT * FROM users WHERE (instr(first_name || ' ' || last_name, ?) > 0 OR instr(about, ?) > 0) AND " +
+				"age >= ? AND age <= ? AND gender = ? AND id IN (?, ?) ORDER BY age DESC, id LIMIT ? OFFSET ?",
+			args: []interface{}{injection, injection, 20, 30, femaleGender, 1, 2, 5, 10},
+		},
+		{
+			params: SearchRequest{Limit: 1, OrderBy: OrderByAsc},
+			query:  "SELECT * FROM users ORDER BY first_name || ' ' || last_name ASC, id LIMIT ? OFFSET ?",
+			args:   []interface{}{1, 0},
+		},
+		{
+			params: SearchRequest{Limit: 1, OrderField: idField, OrderBy: OrderByAsc},
+			query:  "SELECT * FROM users ORDER BY id ASC, id LIMIT ? OFFSET ?",
+			args:   []interface{}{1, 0},
+		},
+	}
+	for caseNum, item := range cases {
+		query, args := buildSearchSQL("SELECT * FROM users", &item.params)
+		if query != item.query || !reflect.DeepEqual(args, item.args) {
+			t.Errorf("[%d] expected %s %v, got %s %v", caseNum, item.query, item.args, query, args)
+		}
+	}
+}
+
+func TestSQLRepository(t *testing.T) {
+	if _, err := NewSQLRepository(nil, "users; DROP TABLE users"); err == nil {
+		t.Errorf("expected invalid table name error")
+	}
+	repository := newTestSQLRepository(t, testData.members)
+	members, err := repository.Users(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sameEntries(t, testData.members, members)
+	if _, err := repository.Users(10); err == nil || !strings.Contains(err.Error(), "more than 10 rows") {
+		t.Errorf("expected max rows error, got %v", err)
+	}
+
+	version, err := repository.Version()
+	if again, _ := repository.Version(); err != nil || len(version) != 16 || again != version {
+		t.Errorf("expected stable version, got %s, %s ( %v )", version, again, err)
+	}
+	if _, err := repository.DB.Exec("UPDATE users SET email = ? WHERE id = ?", "boyd@example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := repository.Version(); changed == version {
+		t.Errorf("expected version to change with content")
+	}
+
+	// rows are validated as rows of files
+	if _, err := repository.DB.Exec("UPDATE users SET gender = ? WHERE id = ?", "cat", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.Users(0); err == nil || !strings.Contains(err.Error(), `row 2: invalid gender "cat"`) {
+		t.Errorf("expected invalid gender error, got %v", err)
+	}
+	if _, err := repository.DB.Exec("UPDATE users SET balance = ? WHERE id = ?", "lots", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.Users(0); err == nil || !strings.Contains(err.Error(), `row 2: column balance: invalid amount "lots"`) {
+		t.Errorf("expected invalid balance error, got %v", err)
+	}
+	if err := repository.Save(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := repository.Users(0); err == nil || err.Error() != "no users found" {
+		t.Errorf("expected no users error, got %v", err)
+	}
+
+	missing := &SQLRepository{DB: repository.DB, Table: "missing"}
+	if _, err := missing.Users(0); err == nil || !strings.Contains(err.Error(), "error reading table [missing]") {
+		t.Errorf("expected missing table error, got %v", err)
+	}
+	if _, err := missing.Version(); err == nil || !strings.Contains(err.Error(), "error reading table [missing]") {
+		t.Errorf("expected missing table error, got %v", err)
+	}
+	if err := missing.Save(context.Background(), testData.members); err == nil {
+		t.Errorf("expected missing table error")
+	}
+	if _, err := New(Config{Repository: missing}); err == nil {
+		t.Errorf("expected server not to start without users")
+	}
+}
+
+// Searches answered by SQL are the same as searches of loaded dataset.
+func TestSQLSearch(t *testing.T) {
+	repository := newTestSQLRepository(t, testData.members)
+	var logs bytes.Buffer
+	sqlServer, err := New(Config{Repository: repository, Tokens: []string{"token"}, Logger: log.New(&logs, "", 0)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fileServer, err := New(Config{DatasetPath: testDatasetPath, Tokens: []string{"token"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	queries := []string{
+		"limit=10&offset=0&order_by=0",
+		"limit=10&offset=30&order_by=0",
+		"limit=5&offset=3&order_by=-1&order_field=Id&query=commodo",
+		"limit=25&offset=0&order_by=1&order_field=Name&query=commodo e",
+		"limit=25&offset=0&order_by=-1&query=Boyd&fields=Id,Name",
+		"limit=25&offset=0&order_by=1&order_field=Id&query=Boyd&query_mode=substring&match_mode=exact",
+		"limit=25&offset=0&order_by=-1&order_field=Id&gender=female&age_min=25&age_max=35",
+		"limit=25&offset=0&order_by=0&ids=5,1,30&query=e",
+		"limit=25&offset=0&order_by=0&query=x') OR 1=1 --",
+		"limit=3&offset=0&order_by=0&response_version=2",
+		"limit=3&offset=0&order_by=0&response_version=2&fields=Id,Balance,Registered",
+		// answered by loaded dataset
+		"limit=10&offset=0&order_by=-1&order_field=Id&query=boyd&match_mode=case_insensitive",
+		"limit=10&offset=0&order_by=0&query=Boyd&highlight=true",
+		"limit=10&offset=0&order_by=0&order_field=Relevance&query=commodo",
+	}
+	for caseNum, query := range queries {
+		bodies := [2]string{}
+		for i, server := range []*Server{sqlServer, fileServer} {
+			r := httptest.NewRequest(http.MethodGet, "/?"+strings.ReplaceAll(query, " ", "+"), nil)
+			r.Header.Set(accessTokenHeader, "token")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("[%d] expected 200, got %d %s", caseNum, w.Code, w.Body)
+			}
+			bodies[i] = w.Body.String()
+		}
+		if bodies[0] != bodies[1] {
+			t.Errorf("[%d] %s: expected %s, got %s", caseNum, query, bodies[1], bodies[0])
+		}
+	}
+
+	// table is searched directly, loaded dataset catches up on reload
+	if _, err := repository.DB.Exec("UPDATE users SET first_name = ? WHERE id = ?", "Floyd", 0); err != nil {
+		t.Fatal(err)
+	}
+	if names := searchNames(t, sqlServer, "Floyd"); names != `[{"Name":"Floyd Wolf"}]` {
+		t.Errorf("expected Floyd Wolf, got %s", names)
+	}
+	if version, err := sqlServer.Reload(); err != nil || version.Version == fileServer.Version().Version {
+		t.Errorf("expected table to be reloaded, got %#v ( %v )", version, err)
+	}
+	if names := searchNames(t, sqlServer, "Floyd&query_mode=boolean"); names != `[{"Name":"Floyd Wolf"}]` {
+		t.Errorf("expected Floyd Wolf in loaded dataset, got %s", names)
+	}
+
+	// failed search is logged
+	if _, err := repository.DB.Exec("DROP TABLE users"); err != nil {
+		t.Fatal(err)
+	}
+	if body := searchNames(t, sqlServer, "Boyd"); !strings.Contains(body, "internal server error") {
+		t.Errorf("expected internal server error, got %s", body)
+	}
+	if !strings.Contains(logs.String(), "repository search failed: ") {
+		t.Errorf("expected failure to be logged, got %s", logs.String())
+	}
+}
@@ -0,0 +1,105 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+	suggestOrderFreq    = "frequency"
+	suggestOrderAlpha   = "alphabetical"
+)
+
+var (
+	SuggestPrefixError = &badRequestError{reason: "prefix must not be empty"}
+	SuggestLimitError  = &badRequestError{reason: fmt.Sprintf("limit must be between 1 and %d", maxSuggestLimit)}
+	SuggestOrderError  = &badRequestError{reason: "invalid order"}
+)
+
+type suggestEntry struct {
+	key   string // folded text, entries are sorted by it
+	text  string
+	count int // number of users having this name
+}
+
+// Sorted-prefix index over first, last and full names: entries with the same prefix are adjacent,
+// so lookup is a binary search followed by a scan of matching entries only.
+type suggestIndex struct {
+	entries []suggestEntry
+}
+
+func buildSuggestIndex(users []UserEntry) *suggestIndex {
+	counts := make(map[string]int)
+	for _, entry := range users {
+		for _, name := range []string{entry.FirstName, entry.LastName, entry.FirstName + " " + entry.LastName} {
+			if name = strings.TrimSpace(name); name != "" {
+				counts[name]++
+			}
+		}
+	}
+	index := &suggestIndex{entries: make([]suggestEntry, 0, len(counts))}
+	for text, count := range counts {
+		index.entries = append(index.entries, suggestEntry{key: foldText(text, true), text: text, count: count})
+	}
+	sort.Slice(index.entries, func(i, j int) bool {
+		left, right := index.entries[i], index.entries[j]
+		return left.key < right.key || left.key == right.key && left.text < right.text
+	})
+	return index
+}
+
+// Names starting with prefix ( case and diacritics are ignored ), most frequent first
+// or alphabetically, not more than limit.
+func (index *suggestIndex) suggest(prefix string, limit int, order string) []Suggestion {
+	key := foldText(prefix, true)
+	start := sort.Search(len(index.entries), func(i int) bool { return index.entries[i].key >= key })
+	found := []suggestEntry{}
+	for i := start; i < len(index.entries) && strings.HasPrefix(index.entries[i].key, key); i++ {
+		found = append(found, index.entries[i])
+	}
+	if order != suggestOrderAlpha {
+		sort.SliceStable(found, func(i, j int) bool { return found[i].count > found[j].count })
+	}
+	suggestions := make([]Suggestion, 0, min(limit, len(found)))
+	for _, entry := range found[:min(limit, len(found))] {
+		suggestions = append(suggestions, Suggestion{Text: entry.text, Count: entry.count})
+	}
+	return suggestions
+}
+
+func (s *Server) suggest(data *dataset, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix := strings.TrimSpace(q.Get("prefix"))
+	if prefix == "" {
+		handleBadRequest(w, SuggestPrefixError)
+		return
+	}
+	limit := defaultSuggestLimit
+	if q.Get("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(q.Get("limit")); err != nil || limit < 1 || limit > maxSuggestLimit {
+			handleBadRequest(w, SuggestLimitError)
+			return
+		}
+	}
+	if err := validateAllowedValues(q.Get("order"), "", suggestOrderFreq, suggestOrderAlpha); err != nil {
+		handleBadRequest(w, SuggestOrderError)
+		return
+	}
+	response, err := json.Marshal(data.suggest.suggest(prefix, limit, q.Get("order")))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	n, err := w.Write(response)
+	if n != len(response) || err != nil {
+		panic("failed to process response")
+	}
+}
@@ -0,0 +1,32 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestIndex(t *testing.T) {
+	index := buildSuggestIndex([]UserEntry{
+		{FirstName: "Boyd", LastName: "Wolf"},
+		{FirstName: "Bob", LastName: "Wolf"},
+		{FirstName: "Böb", LastName: "Bauer"},
+		{FirstName: "Anna", LastName: "Bob"},
+	})
+	cases := []struct {
+		prefix   string
+		limit    int
+		order    string
+		expected []Suggestion
+	}{
+		{prefix: "bo", limit: 10, expected: []Suggestion{{"Bob", 2}, {"Böb", 1}, {"Böb Bauer", 1}, {"Bob Wolf", 1}, {"Boyd", 1}, {"Boyd Wolf", 1}}},
+		{prefix: "BO", limit: 2, order: suggestOrderAlpha, expected: []Suggestion{{"Bob", 2}, {"Böb", 1}}},
+		{prefix: "boyd w", limit: 10, expected: []Suggestion{{"Boyd Wolf", 1}}},
+		{prefix: "W", limit: 10, expected: []Suggestion{{"Wolf", 2}}},
+		{prefix: "x", limit: 10, expected: []Suggestion{}},
+	}
+	for caseNum, item := range cases {
+		if got := index.suggest(item.prefix, item.limit, item.order); !reflect.DeepEqual(item.expected, got) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, item.expected, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package searchserver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeSearch  = "search"   // search and name suggestions
+	ScopeReadPII = "read-pii" // full user records: response_version=2 and GET /users/{id}
+	ScopeWrite   = "write"    // POST, PUT, PATCH and DELETE /users
+	ScopeAdmin   = "admin"    // /admin/ endpoints
+
+	tokenSaltSize = 16
+)
+
+// Token is an entry of token config file ( see LoadTokenStore ). Value of token is not kept, only its salted hash.
+type Token struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"` // hex of salt and SHA-256 of salt and token separated by ":", see HashToken
+	Scopes  []string  `json:"scopes"`
+	Expires time.Time `json:"expires"` // never if zero
+	Enabled *bool     `json:"enabled"` // true if not set
+}
+
+func (token *Token) hasScope(scope string) bool {
+	return slices.Contains(token.Scopes, scope)
+}
+
+// TokenStore authorizes values of AccessToken header.
+type TokenStore struct {
+	tokens []storedToken
+}
+
+type storedToken struct {
+	Token
+	salt, sum []byte
+}
+
+// HashToken returns a salted hash of token for Token.Hash, every call uses a new random salt.
+func HashToken(token string) string {
+	salt := make([]byte, tokenSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err) // crypto/rand doesn't fail on supported platforms
+	}
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(saltedSum(salt, token))
+}
+
+func saltedSum(salt []byte, token string) []byte {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(token))
+	return hash.Sum(nil)
+}
+
+// NewTokenStore checks that tokens have unique names, known scopes and valid hashes.
+func NewTokenStore(tokens []Token) (*TokenStore, error) {
+	store, names := &TokenStore{}, make(map[string]bool, len(tokens))
+	for i, token := range tokens {
+		if token.Name == "" || names[token.Name] {
+			return nil, fmt.Errorf("token %d: empty or duplicate name %q", i+1, token.Name)
+		}
+		names[token.Name] = true
+		for _, scope := range token.Scopes {
+			if err := validateAllowedValues(scope, ScopeSearch, ScopeReadPII, ScopeWrite, ScopeAdmin); err != nil {
+				return nil, fmt.Errorf("token %s: unknown scope %q", token.Name, scope)
+			}
+		}
+		salt, sum, _ := strings.Cut(token.Hash, ":")
+		stored := storedToken{Token: token}
+		var saltErr, sumErr error
+		stored.salt, saltErr = hex.DecodeString(salt)
+		stored.sum, sumErr = hex.DecodeString(sum)
+		if saltErr != nil || sumErr != nil || len(stored.salt) == 0 || len(stored.sum) != sha256.Size {
+			return nil, fmt.Errorf("token %s: invalid hash, expected salt:sha256 in hex", token.Name)
+		}
+		store.tokens = append(store.tokens, stored)
+	}
+	return store, nil
+}
+
+// LoadTokenStore reads token config file:
+//
+//	{"tokens": [{"name": "ci", "hash": "<HashToken of token>", "scopes": ["search"], "expires": "2030-01-01T00:00:00Z"}]}
+func LoadTokenStore(path string) (*TokenStore, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file [%s]: %w", path, err)
+	}
+	var config struct {
+		Tokens []Token `json:"tokens"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("error parsing token file [%s]: %w", path, err)
+	}
+	store, err := NewTokenStore(config.Tokens)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing token file [%s]: %w", path, err)
+	}
+	return store, nil
+}
+
+// Tokens of Config.Tokens can search and read full records, Config.AdminTokens can change users and use
+// /admin/ endpoints. Token of both lists has all scopes.
+func legacyTokenStore(tokens, adminTokens []string) *TokenStore {
+	store, positions := &TokenStore{}, map[string]int{}
+	add := func(value string, scopes ...string) {
+		position, ok := positions[value]
+		if !ok {
+			salt := make([]byte, tokenSaltSize)
+			rand.Read(salt)
+			position, positions[value] = len(store.tokens), len(store.tokens)
+			store.tokens = append(store.tokens, storedToken{Token: Token{Name: fmt.Sprintf("token-%d", position+1)},
+				salt: salt, sum: saltedSum(salt, value)})
+		}
+		for _, scope := range scopes {
+			if token := &store.tokens[position].Token; !token.hasScope(scope) {
+				token.Scopes = append(token.Scopes, scope)
+			}
+		}
+	}
+	for _, token := range tokens {
+		add(token, ScopeSearch, ScopeReadPII)
+	}
+	for _, token := range adminTokens {
+		add(token, ScopeWrite, ScopeAdmin)
+	}
+	return store
+}
+
+// Lookup finds enabled token which hasn't expired at now. Every token is compared, so time doesn't tell
+// which one matched.
+func (store *TokenStore) Lookup(value string, now time.Time) (*Token, bool) {
+	var found *Token
+	for i := range store.tokens {
+		stored := &store.tokens[i]
+		if subtle.ConstantTimeCompare(saltedSum(stored.salt, value), stored.sum) == 1 {
+			found = &stored.Token
+		}
+	}
+	if found == nil || (found.Enabled != nil && !*found.Enabled) || (!found.Expires.IsZero() && !now.Before(found.Expires)) {
+		return nil, false
+	}
+	return found, true
+}
+
+// Respond with 403 when token lacks scope.
+func permit(w http.ResponseWriter, token *Token, scope string) bool {
+	if !token.hasScope(scope) {
+		handleErrorResponse(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package searchserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	disabled := false
+	store, err := NewTokenStore([]Token{
+		{Name: "search", Hash: HashToken("search-token"), Scopes: []string{ScopeSearch}},
+		{Name: "expired", Hash: HashToken("expired-token"), Scopes: []string{ScopeSearch}, Expires: now},
+		{Name: "disabled", Hash: HashToken("disabled-token"), Scopes: []string{ScopeSearch}, Enabled: &disabled},
+		{Name: "later", Hash: HashToken("later-token"), Scopes: []string{ScopeSearch}, Expires: now.Add(time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for value, name := range map[string]string{"search-token": "search", "later-token": "later", "expired-token": "",
+		"disabled-token": "", "search-token ": "", "": ""} {
+		token, ok := store.Lookup(value, now)
+		if ok != (name != "") || (ok && token.Name != name) {
+			t.Errorf("%q: expected token %q, got %#v", value, name, token)
+		}
+	}
+	if hash := HashToken("search-token"); hash == store.tokens[0].Hash || len(hash) != 2*tokenSaltSize+1+64 {
+		t.Errorf("expected hash with a new salt, got %s", hash)
+	}
+
+	invalid := []struct {
+		tokens []Token
+		err    string
+	}{
+		{[]Token{{Hash: HashToken("a")}}, `token 1: empty or duplicate name ""`},
+		{[]Token{{Name: "a", Hash: HashToken("a")}, {Name: "a", Hash: HashToken("b")}}, `token 2: empty or duplicate name "a"`},
+		{[]Token{{Name: "a", Hash: HashToken("a"), Scopes: []string{"root"}}}, `token a: unknown scope "root"`},
+		{[]Token{{Name: "a", Hash: "a-token"}}, "token a: invalid hash"},
+		{[]Token{{Name: "a", Hash: "00:abcd"}}, "token a: invalid hash"},
+	}
+	for caseNum, item := range invalid {
+		if _, err := NewTokenStore(item.tokens); err == nil || !strings.HasPrefix(err.Error(), item.err) {
+			t.Errorf("[%d] expected error %s, got %v", caseNum, item.err, err)
+		}
+	}
+}
+
+func TestLoadTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	content := `{"tokens": [{"name": "ci", "hash": "` + HashToken("ci-token") + `", "scopes": ["search", "read-pii"],
+		"expires": "2100-01-01T00:00:00Z", "enabled": true}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadTokenStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token, ok := store.Lookup("ci-token", time.Now()); !ok || token.Name != "ci" || !token.hasScope(ScopeReadPII) {
+		t.Errorf("expected ci token, got %#v", token)
+	}
+
+	for content, expected := range map[string]string{
+		`{"tokens": [{"name": "ci", "token": "ci-token"}]}`: "error parsing token file",
+		`{"tokens": [{"name": "ci", "hash": "ci-token"}]}`:  "error parsing token file",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTokenStore(path); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("%s: expected error %s, got %v", content, expected, err)
+		}
+	}
+	if _, err := LoadTokenStore(filepath.Join(dir, "missing.json")); err == nil || !strings.HasPrefix(err.Error(), "error reading token file") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+}
+
+// Valid token without scope of endpoint gets 403, unknown token gets 401.
+func TestScopes(t *testing.T) {
+	store, err := NewTokenStore([]Token{
+		{Name: "search", Hash: HashToken("search"), Scopes: []string{ScopeSearch}},
+		{Name: "pii", Hash: HashToken("pii"), Scopes: []string{ScopeSearch, ScopeReadPII}},
+		{Name: "write", Hash: HashToken("write"), Scopes: []string{ScopeWrite}},
+		{Name: "admin", Hash: HashToken("admin"), Scopes: []string{ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server := newUsersTestServer(t, Config{})
+	server.tokens = store
+	search := "/?limit=1&offset=0&order_by=0"
+	cases := []struct {
+		method, path, token string
+		status              int
+	}{
+		{http.MethodGet, search, "search", http.StatusOK},
+		{http.MethodGet, "/suggest?prefix=bo", "search", http.StatusOK},
+		{http.MethodGet, search + "&response_version=2", "search", http.StatusForbidden},
+		{http.MethodGet, search + "&response_version=2", "pii", http.StatusOK},
+		{http.MethodGet, "/users/0", "search", http.StatusForbidden},
+		{http.MethodGet, "/users/0", "pii", http.StatusOK},
+		{http.MethodDelete, "/users/0", "pii", http.StatusForbidden},
+		{http.MethodDelete, "/users/0", "write", http.StatusNoContent},
+		{http.MethodGet, search, "write", http.StatusForbidden},
+		{http.MethodGet, "/suggest?prefix=bo", "admin", http.StatusForbidden},
+		{http.MethodGet, "/admin/dataset", "write", http.StatusForbidden},
+		{http.MethodGet, "/admin/dataset", "admin", http.StatusOK},
+		{http.MethodGet, "/admin/dataset", "unknown", http.StatusUnauthorized},
+		{http.MethodGet, search, "unknown", http.StatusUnauthorized},
+	}
+	for caseNum, item := range cases {
+		if w := userRequest(server, item.method, item.path, item.token, "", ""); w.Code != item.status {
+			t.Errorf("[%d] %s %s: expected %d, got %d %s", caseNum, item.method, item.path, item.status, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package searchserver
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	usersPath       = "/users"
+	maxUserBodySize = 1 << 20
+)
+
+var (
+	UserNotFoundError       error = errors.New("user not found")
+	UserExistsError         error = errors.New("user exists")
+	UserModifiedError       error = errors.New("user modified") // If-Match doesn't match ETag of user
+	LastUserError           error = errors.New("last user can't be deleted")
+	ReadOnlyRepositoryError error = errors.New("dataset is read-only")
+	DatasetChangedError     error = errors.New("dataset changed, retry after reload") // file changed since it was loaded
+)
+
+// UserRecord is a user of /users endpoints: every field of dataset record, names are separate.
+type UserRecord struct {
+	Id            int
+	FirstName     string
+	LastName      string
+	Age           int
+	About         string
+	Gender        string
+	Guid          string
+	IsActive      bool
+	Balance       Amount
+	Picture       string
+	EyeColor      string
+	Company       string
+	Email         string
+	Phone         string
+	Address       string
+	Registered    time.Time
+	FavoriteFruit string
+}
+
+func (ue *UserEntry) toRecord() UserRecord {
+	return UserRecord{Id: ue.Id, FirstName: ue.FirstName, LastName: ue.LastName, Age: ue.Age, About: ue.About,
+		Gender: ue.Gender, Guid: ue.Guid, IsActive: ue.IsActive, Balance: ue.Balance, Picture: ue.Picture,
+		EyeColor: ue.EyeColor, Company: ue.Company, Email: ue.Email, Phone: ue.Phone, Address: ue.Address,
+		Registered: ue.Registered.Time, FavoriteFruit: ue.FavoriteFruit}
+}
+
+func (record *UserRecord) toEntry() UserEntry {
+	return UserEntry{Id: record.Id, FirstName: record.FirstName, LastName: record.LastName, Age: record.Age,
+		About: record.About, Gender: record.Gender, Guid: record.Guid, IsActive: record.IsActive, Balance: record.Balance,
+		Picture: record.Picture, EyeColor: record.EyeColor, Company: record.Company, Email: record.Email,
+		Phone: record.Phone, Address: record.Address, Registered: registeredTime{Time: record.Registered},
+		FavoriteFruit: record.FavoriteFruit}
+}
+
+// ETag changes with any field of user.
+func (ue *UserEntry) etag() string {
+	content, _ := json.Marshal(ue) // fields of UserEntry always marshal
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Repository which persists changed users as a whole ( see FileRepository.Save ).
+type userSaver interface {
+	Save(ctx context.Context, users []UserEntry) error
+}
+
+// Repository which persists one changed user by id, other users are left as they are
+// ( see SQLRepository and WALRepository ). It is preferred over userSaver.
+type userWriter interface {
+	Create(ctx context.Context, entry UserEntry) error
+	Update(ctx context.Context, entry UserEntry) error
+	Delete(ctx context.Context, id int) error
+}
+
+// Change of one user made by users endpoints: changed copy of served users and the same change for userWriter.
+type userChange struct {
+	members []UserEntry
+	write   func(ctx context.Context, writer userWriter) error
+}
+
+// Users endpoints: POST /users creates user, GET, PUT, PATCH and DELETE /users/{id} read, replace,
+// merge ( RFC 7386 ) and delete it. Reads need ScopeReadPII, changes need ScopeWrite, PUT, PATCH and DELETE take If-Match with ETag
+// of user and fail if user has been changed since.
+func (s *Server) users(data *dataset, token *Token, w http.ResponseWriter, r *http.Request) {
+	id, hasId := 0, r.URL.Path != usersPath
+	if hasId {
+		var err error
+		if id, err = strconv.Atoi(strings.TrimPrefix(r.URL.Path, usersPath+"/")); err != nil || id < 0 {
+			handleErrorResponse(w, http.StatusNotFound, "not found")
+			return
+		}
+	}
+	scope := ScopeWrite
+	if r.Method == http.MethodGet {
+		scope = ScopeReadPII
+	}
+	if !permit(w, token, scope) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUserBodySize)
+	switch {
+	case !hasId && r.Method == http.MethodPost:
+		s.createUser(w, r)
+	case hasId && r.Method == http.MethodGet:
+		entry, ok := data.byId[id]
+		if !ok {
+			s.writeChangeError(w, UserNotFoundError)
+			return
+		}
+		writeUser(w, http.StatusOK, entry)
+	case hasId && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		s.updateUser(w, r, id)
+	case hasId && r.Method == http.MethodDelete:
+		s.deleteUser(w, r, id)
+	default:
+		handleErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleBadRequest(w, userError(err))
+		return
+	}
+	var created UserEntry
+	err = s.changeUsers(r.Context(), func(members []UserEntry) (change userChange, err error) {
+		record, hasId, err := decodeRecord(body, nil)
+		if err != nil {
+			return change, err
+		}
+		if !hasId { // next to the greatest id
+			for i := range members {
+				record.Id = max(record.Id, members[i].Id+1)
+			}
+		}
+		if slices.IndexFunc(members, func(entry UserEntry) bool { return entry.Id == record.Id }) >= 0 {
+			return change, UserExistsError
+		}
+		created = record.toEntry()
+		if err := validateEntry(&created, nil); err != nil {
+			return change, userError(err)
+		}
+		return userChange{members: append(slices.Clip(members), created), write: func(ctx context.Context, writer userWriter) error {
+			return writer.Create(ctx, created)
+		}}, nil
+	})
+	if err != nil {
+		s.writeChangeError(w, err)
+		return
+	}
+	w.Header().Set("Location", usersPath+"/"+strconv.Itoa(created.Id))
+	writeUser(w, http.StatusCreated, &created)
+}
+
+// PUT replaces all fields, missing ones become zero. PATCH replaces fields of body only, null makes field zero.
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request, id int) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleBadRequest(w, userError(err))
+		return
+	}
+	var updated UserEntry
+	err = s.changeUsers(r.Context(), func(members []UserEntry) (change userChange, err error) {
+		position, err := findUser(r, members, id)
+		if err != nil {
+			return change, err
+		}
+		var base *UserRecord
+		if r.Method == http.MethodPatch {
+			current := members[position].toRecord()
+			base = &current
+		}
+		record, hasId, err := decodeRecord(body, base)
+		if err != nil {
+			return change, err
+		}
+		if hasId && record.Id != id {
+			return change, userError(fmt.Errorf("id %d doesn't match id of path", record.Id))
+		}
+		record.Id = id
+		updated = record.toEntry()
+		if err := validateEntry(&updated, nil); err != nil {
+			return change, userError(err)
+		}
+		members = slices.Clone(members)
+		members[position] = updated
+		return userChange{members: members, write: func(ctx context.Context, writer userWriter) error {
+			return writer.Update(ctx, updated)
+		}}, nil
+	})
+	if err != nil {
+		s.writeChangeError(w, err)
+		return
+	}
+	writeUser(w, http.StatusOK, &updated)
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request, id int) {
+	err := s.changeUsers(r.Context(), func(members []UserEntry) (change userChange, err error) {
+		position, err := findUser(r, members, id)
+		if err != nil {
+			return change, err
+		}
+		if len(members) == 1 {
+			return change, LastUserError
+		}
+		return userChange{members: slices.Delete(slices.Clone(members), position, position+1),
+			write: func(ctx context.Context, writer userWriter) error { return writer.Delete(ctx, id) }}, nil
+	})
+	if err != nil {
+		s.writeChangeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Position of user with id, which must match If-Match header if it is set.
+func findUser(r *http.Request, members []UserEntry, id int) (int, error) {
+	position := slices.IndexFunc(members, func(entry UserEntry) bool { return entry.Id == id })
+	if position < 0 {
+		return -1, UserNotFoundError
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return position, nil
+	}
+	etag := members[position].etag()
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return position, nil
+		}
+	}
+	return -1, UserModifiedError
+}
+
+// Decode user JSON, unknown fields are rejected. Fields of body are merged into base if it is set.
+func decodeRecord(body []byte, base *UserRecord) (record UserRecord, hasId bool, err error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return record, false, userError(err)
+	}
+	_, hasId = fields["Id"]
+	if base != nil {
+		merged := map[string]json.RawMessage{}
+		content, _ := json.Marshal(base) // fields of UserRecord always marshal
+		json.Unmarshal(content, &merged)
+		for name, value := range fields {
+			if string(value) == "null" {
+				delete(merged, name)
+			} else {
+				merged[name] = value
+			}
+		}
+		fields = merged
+	}
+	content, _ := json.Marshal(fields)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&record); err != nil {
+		return record, false, userError(err)
+	}
+	return record, hasId, nil
+}
+
+func userError(err error) error {
+	return &badRequestError{reason: "invalid user", detail: err.Error()}
+}
+
+// Change users under reload lock: change gets served users and returns changed copy, which is served then.
+// userWriter persists only the changed user, so rows changed by others are kept: version of changed copy
+// is unknown and repository is read again on the next reload. userSaver persists the copy as a whole,
+// unless dataset has changed since it was loaded. Requests in progress keep their dataset.
+func (s *Server) changeUsers(ctx context.Context, change func(members []UserEntry) (userChange, error)) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	writer, isWriter := s.repository.(userWriter)
+	saver, isSaver := s.repository.(userSaver)
+	if !isWriter && !isSaver {
+		return ReadOnlyRepositoryError
+	}
+	current := s.data.Load()
+	changed, err := change(current.members)
+	if err != nil {
+		return err
+	}
+	var data *dataset
+	if isWriter {
+		if err := changed.write(ctx, writer); err != nil {
+			return err
+		}
+		data = newDataset(changed.members)
+	} else {
+		version, err := s.repository.Version()
+		if err != nil {
+			return err
+		}
+		if version != current.version {
+			return DatasetChangedError
+		}
+		if err := saver.Save(ctx, changed.members); err != nil {
+			return err
+		}
+		data = newDataset(changed.members)
+		if data.version, err = s.repository.Version(); err != nil { // dataset is read again on the next reload
+			s.config.Logger.Printf("dataset version is unknown after save: %s", err)
+		}
+	}
+	if _, err := s.fileChanged(); err == nil { // saved file is not reloaded
+		data.modTime = s.seenModTime
+	}
+	s.data.Store(data)
+	s.setReloadError(nil)
+	s.config.Logger.Printf("dataset saved: version %s, %d users", cmp.Or(data.version, "unknown until reload"), len(data.members))
+	return nil
+}
+
+func (s *Server) writeChangeError(w http.ResponseWriter, err error) {
+	var badRequest *badRequestError
+	switch {
+	case errors.As(err, &badRequest):
+		handleBadRequest(w, err)
+	case errors.Is(err, UserNotFoundError):
+		handleErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, UserExistsError), errors.Is(err, LastUserError), errors.Is(err, DatasetChangedError):
+		handleErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, UserModifiedError):
+		handleErrorResponse(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, ReadOnlyRepositoryError):
+		handleErrorResponse(w, http.StatusNotImplemented, err.Error())
+	default:
+		s.config.Logger.Printf("dataset save failed: %s", err)
+		writeErrorResponse(w, http.StatusInternalServerError, SearchErrorResponse{Error: "save failed", Detail: err.Error()})
+	}
+}
+
+func writeUser(w http.ResponseWriter, status int, entry *UserEntry) {
+	response, err := json.Marshal(entry.toRecord())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", entry.etag())
+	w.WriteHeader(status)
+	if _, err := w.Write(response); err != nil {
+		panic("failed to process response")
+	}
+}
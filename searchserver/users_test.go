@@ -0,0 +1,261 @@
+package searchserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newUsersTestServer(t *testing.T, config Config) *Server {
+	t.Helper()
+	if config.Repository == nil {
+		content, err := os.ReadFile(testDatasetPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.DatasetPath = filepath.Join(t.TempDir(), "dataset.xml")
+		if err := os.WriteFile(config.DatasetPath, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.Tokens, config.AdminTokens = []string{"token", "admin"}, []string{"admin"}
+	config.Logger = log.New(io.Discard, "", 0)
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return server
+}
+
+func userRequest(server *Server, method, path, token, ifMatch, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set(accessTokenHeader, token)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+func TestUsers(t *testing.T) {
+	server := newUsersTestServer(t, Config{})
+	users := len(testData.members)
+
+	w := userRequest(server, http.MethodGet, "/users/0", "token", "", "")
+	var boyd UserRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &boyd); w.Code != http.StatusOK || err != nil || boyd.FirstName != "Boyd" ||
+		boyd.Balance.String() != "2144.93" || boyd.Registered.IsZero() {
+		t.Fatalf("expected Boyd, got %d %s", w.Code, w.Body)
+	}
+	etag := w.Header().Get("ETag")
+
+	// create
+	w = userRequest(server, http.MethodPost, "/users", "admin", "",
+		`{"FirstName":"Floyd","LastName":"Wolf","Age":30,"Gender":"male","Balance":"$1,000.50","Registered":"2020-01-02T03:04:05Z"}`)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/users/35" || w.Header().Get("ETag") == "" {
+		t.Fatalf("expected user 35 to be created, got %d %s %v", w.Code, w.Body, w.Header())
+	}
+	if names := searchNames(t, server, "Floyd"); names != `[{"Name":"Floyd Wolf"}]` {
+		t.Errorf("expected Floyd Wolf to be found, got %s", names)
+	}
+	if version := server.Version(); version.Users != users+1 {
+		t.Errorf("expected %d users, got %#v", users+1, version)
+	}
+
+	// replace and merge
+	w = userRequest(server, http.MethodPut, "/users/35", "admin", "", `{"FirstName":"Lloyd","Gender":"male"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"LastName":""`) {
+		t.Errorf("expected user to be replaced, got %d %s", w.Code, w.Body)
+	}
+	w = userRequest(server, http.MethodPatch, "/users/0", "admin", etag, `{"LastName":"Lamb","Company":null}`)
+	var patched UserRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &patched); w.Code != http.StatusOK || err != nil || patched.FirstName != "Boyd" ||
+		patched.LastName != "Lamb" || patched.Company != "" || patched.Balance != boyd.Balance {
+		t.Errorf("expected user to be merged, got %d %s", w.Code, w.Body)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Errorf("expected ETag to change")
+	}
+	if w = userRequest(server, http.MethodPatch, "/users/0", "admin", etag, `{"Age":1}`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected stale ETag to fail, got %d %s", w.Code, w.Body)
+	}
+
+	// delete
+	if w = userRequest(server, http.MethodDelete, "/users/35", "admin", "*", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected user to be deleted, got %d %s", w.Code, w.Body)
+	}
+	if w = userRequest(server, http.MethodGet, "/users/35", "token", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected deleted user not to be found, got %d %s", w.Code, w.Body)
+	}
+
+	// changes are saved to dataset file and are not reloaded as changes of file
+	saved := mustLoadDataset(server.config.DatasetPath)
+	if len(saved.members) != users || saved.byId[0].LastName != "Lamb" || saved.byId[0].About != testData.byId[0].About {
+		t.Errorf("expected changes to be saved, got %#v", saved.byId[0])
+	}
+	before := server.Version()
+	if after, err := server.reload(false); err != nil || after.LoadedAt != before.LoadedAt {
+		t.Errorf("expected saved file not to be reloaded, got %#v ( %v )", after, err)
+	}
+}
+
+func TestUsersErrors(t *testing.T) {
+	server := newUsersTestServer(t, Config{})
+	cases := []struct {
+		method, path, token, ifMatch, body string
+		status                             int
+		reason                             string
+	}{
+		{http.MethodGet, "/users/0", "", "", "", http.StatusUnauthorized, "unauthorized"},
+		{http.MethodPost, "/users", "token", "", `{}`, http.StatusForbidden, "forbidden"},
+		{http.MethodGet, "/users/boyd", "token", "", "", http.StatusNotFound, "not found"},
+		{http.MethodGet, "/users/100", "token", "", "", http.StatusNotFound, "user not found"},
+		{http.MethodGet, "/users", "token", "", "", http.StatusMethodNotAllowed, "method not allowed"},
+		{http.MethodPost, "/users/1", "admin", "", `{}`, http.StatusMethodNotAllowed, "method not allowed"},
+		{http.MethodPost, "/users", "admin", "", `{"Id":1,"Gender":"male"}`, http.StatusConflict, "user exists"},
+		{http.MethodPost, "/users", "admin", "", `{"Name":"Boyd Wolf"}`, http.StatusBadRequest, "invalid user"},
+		{http.MethodPost, "/users", "admin", "", `{"Gender":"cat"}`, http.StatusBadRequest, "invalid user"},
+		{http.MethodPost, "/users", "admin", "", `{"Age":"old"}`, http.StatusBadRequest, "invalid user"},
+		{http.MethodPost, "/users", "admin", "", `[]`, http.StatusBadRequest, "invalid user"},
+		{http.MethodPost, "/users", "admin", "", `{"Balance":"` + strings.Repeat("1", maxUserBodySize) + `"}`, http.StatusBadRequest, "invalid user"},
+		{http.MethodPut, "/users/1", "admin", "", `{"Id":2,"Gender":"male"}`, http.StatusBadRequest, "invalid user"},
+		{http.MethodPut, "/users/100", "admin", "", `{"Gender":"male"}`, http.StatusNotFound, "user not found"},
+		{http.MethodPatch, "/users/1", "admin", `"0000000000000000"`, `{"Age":1}`, http.StatusPreconditionFailed, "user modified"},
+		{http.MethodDelete, "/users/100", "admin", "", "", http.StatusNotFound, "user not found"},
+	}
+	for caseNum, item := range cases {
+		w := userRequest(server, item.method, item.path, item.token, item.ifMatch, item.body)
+		var response SearchErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != item.status || response.Error != item.reason {
+			t.Errorf("[%d] expected %d %s, got %d %s", caseNum, item.status, item.reason, w.Code, w.Body)
+		}
+	}
+	if version := server.Version(); version.Users != len(testData.members) {
+		t.Errorf("expected users not to change, got %#v", version)
+	}
+
+	// file changed since it was loaded is not overwritten
+	changed := newUsersTestServer(t, Config{})
+	file, err := os.OpenFile(changed.config.DatasetPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("\n")
+	file.Close()
+	if w := userRequest(changed, http.MethodDelete, "/users/0", "admin", "", ""); w.Code != http.StatusConflict ||
+		!strings.Contains(w.Body.String(), "dataset changed") {
+		t.Errorf("expected changed dataset to fail, got %d %s", w.Code, w.Body)
+	}
+	if _, err := changed.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if w := userRequest(changed, http.MethodDelete, "/users/0", "admin", "", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected user to be deleted after reload, got %d %s", w.Code, w.Body)
+	}
+
+	// the last user stays
+	single := newUsersTestServer(t, Config{Repository: newTestSQLRepository(t, testData.members[:1])})
+	if w := userRequest(single, http.MethodDelete, "/users/0", "admin", "", ""); w.Code != http.StatusConflict {
+		t.Errorf("expected last user not to be deleted, got %d %s", w.Code, w.Body)
+	}
+
+	// repositories without Save are read-only
+	readOnly := newUsersTestServer(t, Config{Repository: readOnlyRepository{&FileRepository{Path: testDatasetPath, Format: FormatXML}}})
+	if w := userRequest(readOnly, http.MethodDelete, "/users/0", "admin", "", ""); w.Code != http.StatusNotImplemented {
+		t.Errorf("expected read-only dataset, got %d %s", w.Code, w.Body)
+	}
+
+	// failed save keeps users
+	repository := newTestSQLRepository(t, testData.members)
+	failing := newUsersTestServer(t, Config{Repository: repository})
+	if _, err := repository.DB.Exec("DROP TABLE users"); err != nil {
+		t.Fatal(err)
+	}
+	w := userRequest(failing, http.MethodDelete, "/users/0", "admin", "", "")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "save failed") {
+		t.Errorf("expected save to fail, got %d %s", w.Code, w.Body)
+	}
+	if w := userRequest(failing, http.MethodGet, "/users/0", "token", "", ""); w.Code != http.StatusOK {
+		t.Errorf("expected user to stay, got %d %s", w.Code, w.Body)
+	}
+}
+
+type readOnlyRepository struct {
+	UserRepository
+}
+
+// Users changed through SQL repository are saved to the table.
+func TestUsersSQL(t *testing.T) {
+	repository := newTestSQLRepository(t, testData.members)
+	server := newUsersTestServer(t, Config{Repository: repository})
+	w := userRequest(server, http.MethodPatch, "/users/1", "admin", "", `{"Email":"hilda@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected user to be changed, got %d %s", w.Code, w.Body)
+	}
+	members, err := repository.Users(0)
+	if err != nil || members[1].Email != "hilda@example.com" {
+		t.Errorf("expected email to be saved, got %#v ( %v )", members[1], err)
+	}
+	if version := server.Version().Version; version != "" {
+		t.Errorf("expected version to be unknown until reload, got %s", version)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"Email":"hilda@example.com"`)) {
+		t.Errorf("expected changed user, got %s", w.Body)
+	}
+
+	// only changed row is written, rows changed by others are kept and served after reload
+	if _, err := repository.DB.Exec("UPDATE users SET email = 'rose@example.com' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.DB.Exec("DELETE FROM users WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if w := userRequest(server, http.MethodDelete, "/users/4", "admin", "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected user to be deleted, got %d %s", w.Code, w.Body)
+	}
+	if _, err := server.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := repository.Version(); version != server.Version().Version {
+		t.Errorf("expected served version %s, got %s", version, server.Version().Version)
+	}
+	if w := userRequest(server, http.MethodGet, "/users/2", "token", "", ""); !strings.Contains(w.Body.String(), `"Email":"rose@example.com"`) {
+		t.Errorf("expected email changed in table, got %d %s", w.Code, w.Body)
+	}
+	if version := server.Version(); version.Users != len(testData.members)-2 {
+		t.Errorf("expected %d users, got %#v", len(testData.members)-2, version)
+	}
+
+	// row changed by others is found by id in table
+	if _, err := repository.DB.Exec("DELETE FROM users WHERE id = 5"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.DB.Exec("INSERT INTO users (id, gender) VALUES (100, 'male')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.DB.Exec("CREATE UNIQUE INDEX users_email ON users (email)"); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPatch, "/users/5", `{"Age":1}`, http.StatusNotFound},
+		{http.MethodDelete, "/users/5", "", http.StatusNotFound},
+		{http.MethodPost, "/users", `{"Id":100,"Gender":"male"}`, http.StatusConflict},
+		{http.MethodPost, "/users", `{"Id":101,"Gender":"male","Email":"` + testData.members[0].Email + `"}`, http.StatusInternalServerError}, // not id
+	}
+	for caseNum, item := range cases {
+		if w := userRequest(server, item.method, item.path, "admin", "", item.body); w.Code != item.status {
+			t.Errorf("[%d] expected %d, got %d %s", caseNum, item.status, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package searchserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	SyncAlways   = "always"   // fsync after every record: saved change survives a crash of machine
+	SyncInterval = "interval" // fsync every WALOptions.SyncInterval: changes of the last interval can be lost
+	SyncNever    = "never"    // left to OS: saved change survives a crash of process, not of machine
+
+	walLogName             = "wal.log"
+	walSnapshotName        = "snapshot.jsonl"
+	walHeaderSize          = 8        // length and CRC-32C of payload, little endian
+	maxWALRecordSize       = 64 << 20 // longer record is garbage of torn header
+	defaultSnapshotRecords = 1000
+	defaultSyncInterval    = time.Second
+)
+
+var walChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+type WALOptions struct {
+	Sync            string        // one of Sync*, SyncAlways if empty
+	SyncInterval    time.Duration // how often SyncInterval flushes the log, 1s if 0
+	SnapshotRecords int           // log is compacted into snapshot after this many records, 1000 if 0
+}
+
+// WALRecovery describes what was read from the log on start.
+type WALRecovery struct {
+	Records int   // replayed over the snapshot
+	Dropped int64 // bytes of torn tail, which were cut off the log
+}
+
+// WALRepository keeps users in memory and makes every change durable with an append-only log before it
+// is acknowledged. Log is compacted into a snapshot every WALOptions.SnapshotRecords records. On start the
+// log is replayed over the last snapshot, a torn final record ( e.g. crash in the middle of a write ) is
+// dropped, a broken record followed by a complete one fails the start.
+//
+// Directory holds snapshot.jsonl ( users in FormatJSONL ) and wal.log, a sequence of records:
+//
+//	length uint32 | crc32c uint32 ( of length and payload ) | payload ( JSON of walRecord )
+type WALRepository struct {
+	Recovery WALRecovery
+
+	dir      string
+	options  WALOptions
+	snapshot *FileRepository
+	mu       sync.Mutex
+	members  []UserEntry
+	log      *os.File
+	size     int64 // of valid records in log
+	records  int   // in log since the last snapshot
+	dirty    bool  // written, but not flushed yet by SyncInterval
+	syncErr  error // of background flush, returned by the next Save
+	broken   error // of cutting off failed record, log can't be appended to
+	stop     chan struct{}
+	done     chan struct{}
+	closed   sync.Once
+	closeErr error
+}
+
+// walRecord is one change of users: records are idempotent, so replaying them over a snapshot which
+// already has them ( crash between snapshot and log truncation ) gives the same users.
+type walRecord struct {
+	Put    []UserEntry `json:",omitempty"` // replaced or added at the end
+	Delete []int       `json:",omitempty"` // ids
+}
+
+// NewWALRepository recovers users from dir. Users of seed make the first snapshot when dir has none,
+// seed is not used afterwards and may be nil then. Close flushes and closes the log.
+func NewWALRepository(dir string, seed UserRepository, options WALOptions) (*WALRepository, error) {
+	if options.Sync == "" {
+		options.Sync = SyncAlways
+	}
+	if err := validateAllowedValues(options.Sync, SyncAlways, SyncInterval, SyncNever); err != nil {
+		return nil, fmt.Errorf("unknown sync policy %q", options.Sync)
+	}
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = defaultSyncInterval
+	}
+	if options.SnapshotRecords <= 0 {
+		options.SnapshotRecords = defaultSnapshotRecords
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	repository := &WALRepository{dir: dir, options: options,
+		snapshot: &FileRepository{Path: filepath.Join(dir, walSnapshotName), Format: FormatJSONL}}
+	if err := repository.recover(seed); err != nil {
+		if repository.log != nil {
+			repository.log.Close()
+		}
+		return nil, err
+	}
+	if options.Sync == SyncInterval {
+		repository.stop, repository.done = make(chan struct{}), make(chan struct{})
+		go repository.flush()
+	}
+	return repository, nil
+}
+
+func (repository *WALRepository) recover(seed UserRepository) error {
+	members, err := repository.snapshot.Users(0)
+	if errors.Is(err, fs.ErrNotExist) && seed != nil {
+		if members, err = seed.Users(0); err != nil {
+			return err
+		}
+		err = repository.writeSnapshot(members)
+	}
+	if err != nil {
+		return err
+	}
+	repository.members = members
+	if repository.log, err = os.OpenFile(filepath.Join(repository.dir, walLogName), os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return err
+	}
+	info, err := repository.log.Stat()
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(repository.log)
+	for {
+		record, size, err := readWALRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil { // torn tail is dropped, broken record followed by a complete one is corruption
+			tail := make([]byte, info.Size()-repository.size)
+			if _, err := repository.log.ReadAt(tail, repository.size); err != nil {
+				return err
+			}
+			if next := nextWALRecord(tail); next > 0 {
+				return fmt.Errorf("log is corrupted at offset %d, record at offset %d follows: %w", repository.size,
+					repository.size+int64(next), err)
+			}
+			break
+		}
+		repository.apply(record)
+		repository.size += size
+		repository.records++
+	}
+	repository.Recovery = WALRecovery{Records: repository.records, Dropped: info.Size() - repository.size}
+	if repository.Recovery.Dropped > 0 {
+		if err := repository.log.Truncate(repository.size); err != nil {
+			return err
+		}
+		if err := repository.log.Sync(); err != nil {
+			return err
+		}
+	}
+	_, err = repository.log.Seek(repository.size, io.SeekStart)
+	return err
+}
+
+// Read the next record with its size in log. io.EOF means the log ends with a complete record.
+func readWALRecord(r io.Reader) (record walRecord, size int64, err error) {
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return record, 0, errors.New("torn record header")
+		}
+		return record, 0, err
+	}
+	length, checksum := binary.LittleEndian.Uint32(header), binary.LittleEndian.Uint32(header[4:])
+	if length > maxWALRecordSize {
+		return record, 0, fmt.Errorf("record length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record, 0, errors.New("torn record")
+	}
+	if walChecksum(header, payload) != checksum {
+		return record, 0, errors.New("record checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return record, 0, err
+	}
+	return record, walHeaderSize + int64(length), nil
+}
+
+// CRC-32C of length in header and payload: broken length doesn't pass for a torn record.
+func walChecksum(header, payload []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header[:4], walChecksumTable), walChecksumTable, payload)
+}
+
+// Offset of the first complete record in tail after a broken one at its start, 0 if there is none. Every
+// offset is tried, as length of the broken record can't be trusted.
+func nextWALRecord(tail []byte) int {
+	for offset := 1; offset+walHeaderSize <= len(tail); offset++ {
+		if length := binary.LittleEndian.Uint32(tail[offset:]); int64(length) > int64(len(tail)-offset-walHeaderSize) {
+			continue
+		}
+		if _, _, err := readWALRecord(bytes.NewReader(tail[offset:])); err == nil {
+			return offset
+		}
+	}
+	return 0
+}
+
+func (repository *WALRepository) apply(record walRecord) {
+	for _, entry := range record.Put {
+		if position := repository.position(entry.Id); position < 0 {
+			repository.members = append(repository.members, entry)
+		} else {
+			repository.members[position] = entry
+		}
+	}
+	repository.members = slices.DeleteFunc(repository.members, func(member UserEntry) bool {
+		return slices.Contains(record.Delete, member.Id)
+	})
+}
+
+// Changes from served users to users saved by server.
+func diffUsers(current, users []UserEntry) walRecord {
+	record, kept := walRecord{}, make(map[int]string, len(current))
+	for i := range current {
+		kept[current[i].Id] = current[i].etag()
+	}
+	for i := range users {
+		if etag, ok := kept[users[i].Id]; !ok || etag != users[i].etag() {
+			record.Put = append(record.Put, users[i])
+		}
+		delete(kept, users[i].Id)
+	}
+	for i := range current {
+		if _, ok := kept[current[i].Id]; ok {
+			record.Delete = append(record.Delete, current[i].Id)
+		}
+	}
+	return record
+}
+
+// Save appends changes between kept and given users to the log as one record. Change is kept once the
+// record is written ( and flushed with SyncAlways ).
+func (repository *WALRepository) Save(ctx context.Context, users []UserEntry) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	record := diffUsers(repository.members, users)
+	if len(record.Put) == 0 && len(record.Delete) == 0 {
+		return repository.takeSyncErr()
+	}
+	return repository.write(ctx, record, func() { repository.members = slices.Clone(users) })
+}
+
+// Create appends a record of user, it fails with UserExistsError if id is taken.
+func (repository *WALRepository) Create(ctx context.Context, entry UserEntry) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	if repository.position(entry.Id) >= 0 {
+		return UserExistsError
+	}
+	record := walRecord{Put: []UserEntry{entry}}
+	return repository.write(ctx, record, func() { repository.apply(record) })
+}
+
+// Update appends a record of user, it fails with UserNotFoundError if there is no such user.
+func (repository *WALRepository) Update(ctx context.Context, entry UserEntry) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	if repository.position(entry.Id) < 0 {
+		return UserNotFoundError
+	}
+	record := walRecord{Put: []UserEntry{entry}}
+	return repository.write(ctx, record, func() { repository.apply(record) })
+}
+
+// Delete appends a record of deleted id, it fails with UserNotFoundError if there is no such user.
+func (repository *WALRepository) Delete(ctx context.Context, id int) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	if repository.position(id) < 0 {
+		return UserNotFoundError
+	}
+	record := walRecord{Delete: []int{id}}
+	return repository.write(ctx, record, func() { repository.apply(record) })
+}
+
+func (repository *WALRepository) position(id int) int {
+	return slices.IndexFunc(repository.members, func(member UserEntry) bool { return member.Id == id })
+}
+
+// Error of background flush is returned once.
+func (repository *WALRepository) takeSyncErr() error {
+	if err := repository.syncErr; err != nil {
+		repository.syncErr = nil
+		return fmt.Errorf("error flushing log: %w", err)
+	}
+	return nil
+}
+
+// Write record to the log, then keep the change with keep.
+func (repository *WALRepository) write(ctx context.Context, record walRecord, keep func()) error {
+	if err := repository.takeSyncErr(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:], walChecksum(frame, payload))
+	if err := repository.append(append(frame, payload...)); err != nil {
+		return fmt.Errorf("error writing log: %w", err)
+	}
+	keep()
+	repository.records++
+	if repository.records >= repository.options.SnapshotRecords {
+		repository.compact() // on failure log keeps growing, snapshot is tried again on the next save
+	}
+	return nil
+}
+
+// Record which is not written or not flushed is cut off, so it isn't replayed after restart and the next
+// one doesn't follow garbage. If it can't be cut off, log is broken and every next change fails.
+func (repository *WALRepository) append(frame []byte) error {
+	if repository.broken != nil {
+		return fmt.Errorf("log is broken: %w", repository.broken)
+	}
+	_, err := repository.log.Write(frame)
+	if err == nil && repository.options.Sync == SyncAlways {
+		err = repository.log.Sync()
+	}
+	if err != nil {
+		if err := repository.log.Truncate(repository.size); err != nil {
+			repository.broken = err
+		} else if _, err := repository.log.Seek(repository.size, io.SeekStart); err != nil {
+			repository.broken = err
+		}
+		return err
+	}
+	repository.size += int64(len(frame))
+	if repository.options.Sync == SyncInterval {
+		repository.dirty = true
+	}
+	return nil
+}
+
+// Snapshot writes kept users into snapshot and empties the log.
+func (repository *WALRepository) Snapshot() error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	return repository.compact()
+}
+
+func (repository *WALRepository) compact() error {
+	if err := repository.writeSnapshot(repository.members); err != nil {
+		return err
+	}
+	if err := repository.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := repository.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	repository.size, repository.records, repository.dirty = 0, 0, false
+	return repository.log.Sync()
+}
+
+// Snapshot file is replaced by rename, directory is flushed to keep the rename.
+func (repository *WALRepository) writeSnapshot(members []UserEntry) error {
+	if err := repository.snapshot.Save(context.Background(), members); err != nil {
+		return err
+	}
+	dir, err := os.Open(repository.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Flush log every SyncInterval until Close.
+func (repository *WALRepository) flush() {
+	defer close(repository.done)
+	ticker := time.NewTicker(repository.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-repository.stop:
+			return
+		case <-ticker.C:
+			repository.mu.Lock()
+			if repository.dirty {
+				repository.syncErr, repository.dirty = repository.log.Sync(), false
+			}
+			repository.mu.Unlock()
+		}
+	}
+}
+
+// Close flushes and closes the log, the next calls return the same result.
+func (repository *WALRepository) Close() error {
+	repository.closed.Do(func() {
+		if repository.stop != nil {
+			close(repository.stop)
+			<-repository.done
+		}
+		repository.mu.Lock()
+		defer repository.mu.Unlock()
+		repository.closeErr = repository.log.Sync()
+		if err := repository.log.Close(); repository.closeErr == nil {
+			repository.closeErr = err
+		}
+	})
+	return repository.closeErr
+}
+
+// Users are validated as rows of files.
+func (repository *WALRepository) Users(maxRows int) ([]UserEntry, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	rows := newRowCollector(maxRows)
+	for i := range repository.members {
+		if err := rows.reserve(); err != nil {
+			return nil, err
+		}
+		entry := repository.members[i]
+		if err := rows.add(&entry, 0); err != nil {
+			return nil, err
+		}
+	}
+	return rows.result()
+}
+
+// Version is a hash of kept users.
+func (repository *WALRepository) Version() (string, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	hash := sha256.New()
+	if err := json.NewEncoder(hash).Encode(repository.members); err != nil {
+		return "", err
+	}
+	return contentVersion(hash), nil
+}
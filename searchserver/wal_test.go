@@ -0,0 +1,280 @@
+package searchserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWAL(t *testing.T, dir string, options WALOptions) *WALRepository {
+	t.Helper()
+	repository, err := NewWALRepository(dir, &FileRepository{Path: testDatasetPath, Format: FormatXML}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+	return repository
+}
+
+// Three changes of users: update of the first, delete of the second and a new one. Users after every change
+// are returned.
+func saveTestChanges(t *testing.T, repository *WALRepository) [][]UserEntry {
+	t.Helper()
+	users := slices.Clone(testData.members)
+	users[0].Email = "boyd@example.com"
+	states := [][]UserEntry{slices.Clone(users)}
+	users = slices.Delete(users, 1, 2)
+	states = append(states, slices.Clone(users))
+	users = append(users, UserEntry{Id: 100, FirstName: "Floyd", LastName: "Wolf", Gender: maleGender})
+	states = append(states, users)
+	for _, state := range states {
+		if err := repository.Save(context.Background(), state); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	return states
+}
+
+func recoveredUsers(t *testing.T, dir string) (*WALRepository, []UserEntry) {
+	t.Helper()
+	repository, err := NewWALRepository(dir, nil, WALOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+	users, err := repository.Users(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return repository, users
+}
+
+func TestWALRecovery(t *testing.T) {
+	dir := t.TempDir()
+	repository := newTestWAL(t, dir, WALOptions{})
+	states := saveTestChanges(t, repository)
+	version, _ := repository.Version()
+	if err := repository.Save(context.Background(), states[2]); err != nil { // nothing changed, nothing written
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := repository.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	recovered, users := recoveredUsers(t, dir)
+	sameEntries(t, states[2], users)
+	if recovered.Recovery != (WALRecovery{Records: 3}) {
+		t.Errorf("expected 3 records replayed, got %#v", recovered.Recovery)
+	}
+	if again, _ := recovered.Version(); again != version {
+		t.Errorf("expected version %s, got %s", version, again)
+	}
+	if _, err := recovered.Users(10); err == nil {
+		t.Errorf("expected max rows error")
+	}
+
+	if _, err := NewWALRepository(t.TempDir(), nil, WALOptions{}); err == nil {
+		t.Errorf("expected error without snapshot and seed")
+	}
+	if _, err := NewWALRepository(t.TempDir(), nil, WALOptions{Sync: "sometimes"}); err == nil {
+		t.Errorf("expected unknown sync policy error")
+	}
+}
+
+// Crash in the middle of the last write leaves a part of record, which is dropped on recovery. Changes
+// saved after recovery follow the last complete record.
+func TestWALTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	repository := newTestWAL(t, dir, WALOptions{})
+	states := saveTestChanges(t, repository)
+	repository.Close()
+	logPath := filepath.Join(dir, walLogName)
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, complete := bytes.NewReader(content), int64(0) // size of the first two records
+	for i := 0; i < 2; i++ {
+		_, size, err := readWALRecord(reader)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		complete += size
+	}
+
+	cases := map[string]func(content []byte) []byte{
+		"torn payload":  func(content []byte) []byte { return content[:len(content)-1] },
+		"torn header":   func(content []byte) []byte { return content[:complete+3] },
+		"only header":   func(content []byte) []byte { return content[:complete+walHeaderSize] },
+		"flipped byte":  func(content []byte) []byte { content[len(content)-2] ^= 1; return content },
+		"garbage":       func(content []byte) []byte { return append(content[:complete], 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1) },
+		"broken length": func(content []byte) []byte { content[complete] ^= 1; return content },
+	}
+	for name, tear := range cases {
+		torn := tear(slices.Clone(content))
+		if err := os.WriteFile(logPath, torn, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		recovered, users := recoveredUsers(t, dir)
+		sameEntries(t, states[1], users)
+		if recovered.Recovery != (WALRecovery{Records: 2, Dropped: int64(len(torn) - int(complete))}) {
+			t.Errorf("%s: unexpected recovery %#v", name, recovered.Recovery)
+		}
+		if info, err := os.Stat(logPath); err != nil || info.Size() != complete {
+			t.Errorf("%s: expected log to be cut to %d bytes, got %v ( %v )", name, complete, info.Size(), err)
+		}
+		if err := recovered.Save(context.Background(), states[2]); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		recovered.Close()
+		again, users := recoveredUsers(t, dir)
+		sameEntries(t, states[2], users)
+		if again.Recovery != (WALRecovery{Records: 3}) {
+			t.Errorf("%s: unexpected recovery after save %#v", name, again.Recovery)
+		}
+		again.Close()
+	}
+
+	// complete records after a broken one are not dropped, whichever part of it is broken
+	_, first, err := readWALRecord(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	middle := map[string]func(content []byte){
+		"flipped byte":     func(content []byte) { content[first+walHeaderSize+1] ^= 1 },
+		"shorter length":   func(content []byte) { content[first] ^= 1 },
+		"longer length":    func(content []byte) { content[first+1] ^= 1 },
+		"length over max":  func(content []byte) { content[first+3] = 0xff },
+		"flipped checksum": func(content []byte) { content[first+4] ^= 1 },
+	}
+	for name, corrupt := range middle {
+		corrupted := slices.Clone(content)
+		corrupt(corrupted)
+		if err := os.WriteFile(logPath, corrupted, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("log is corrupted at offset %d, record at offset %d follows", first, complete)
+		if _, err := NewWALRepository(dir, nil, WALOptions{}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected corrupted log error, got %v", name, err)
+		}
+		if info, err := os.Stat(logPath); err != nil || info.Size() != int64(len(content)) {
+			t.Errorf("%s: expected corrupted log to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestWALSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	repository := newTestWAL(t, dir, WALOptions{SnapshotRecords: 2})
+	states := saveTestChanges(t, repository)
+	snapshot, err := (&FileRepository{Path: filepath.Join(dir, walSnapshotName), Format: FormatJSONL}).Users(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sameEntries(t, states[1], snapshot) // third record is in the log
+	repository.Close()
+	recovered, users := recoveredUsers(t, dir)
+	sameEntries(t, states[2], users)
+	if recovered.Recovery != (WALRecovery{Records: 1}) {
+		t.Errorf("expected 1 record after snapshot, got %#v", recovered.Recovery)
+	}
+
+	if err := recovered.Snapshot(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, walLogName)); err != nil || info.Size() != 0 {
+		t.Errorf("expected empty log after snapshot, got %v", err)
+	}
+	recovered.Close()
+	if recovered, users := recoveredUsers(t, dir); recovered.Recovery != (WALRecovery{}) {
+		t.Errorf("expected nothing to replay, got %#v", recovered.Recovery)
+	} else {
+		sameEntries(t, states[2], users)
+	}
+}
+
+func TestWALSyncPolicies(t *testing.T) {
+	for _, options := range []WALOptions{{Sync: SyncNever}, {Sync: SyncInterval, SyncInterval: time.Millisecond}} {
+		dir := t.TempDir()
+		repository := newTestWAL(t, dir, options)
+		states := saveTestChanges(t, repository)
+		time.Sleep(10 * time.Millisecond)
+		if err := repository.Close(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", options.Sync, err)
+		}
+		_, users := recoveredUsers(t, dir)
+		sameEntries(t, states[2], users)
+	}
+}
+
+// Changes of users endpoints survive restart of server.
+func TestWALServer(t *testing.T) {
+	dir := t.TempDir()
+	server := newUsersTestServer(t, Config{Repository: newTestWAL(t, dir, WALOptions{})})
+	if w := userRequest(server, http.MethodPatch, "/users/0", "admin", "", `{"FirstName":"Floyd"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected user to be changed, got %d %s", w.Code, w.Body)
+	}
+	if w := userRequest(server, http.MethodPost, "/users", "admin", "", `{"Gender":"male"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected user to be created, got %d %s", w.Code, w.Body)
+	}
+	if w := userRequest(server, http.MethodDelete, "/users/1", "admin", "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected user to be deleted, got %d %s", w.Code, w.Body)
+	}
+	wal := server.repository.(*WALRepository)
+	if wal.records != 3 {
+		t.Errorf("expected a record per change, got %d", wal.records)
+	}
+	errs := []struct{ got, expected error }{
+		{wal.Create(context.Background(), UserEntry{Id: 0}), UserExistsError},
+		{wal.Update(context.Background(), UserEntry{Id: 1}), UserNotFoundError},
+		{wal.Delete(context.Background(), 1), UserNotFoundError},
+	}
+	for caseNum, item := range errs {
+		if item.got != item.expected {
+			t.Errorf("[%d] expected %v, got %v", caseNum, item.expected, item.got)
+		}
+	}
+	wal.Close()
+	restarted := newUsersTestServer(t, Config{Repository: newTestWAL(t, dir, WALOptions{})})
+	if names := searchNames(t, restarted, "Floyd"); names != `[{"Name":"Floyd Wolf"}]` {
+		t.Errorf("expected Floyd Wolf after restart, got %s", names)
+	}
+	if version := restarted.Version(); version.Users != len(testData.members) {
+		t.Errorf("expected %d users after restart, got %#v", len(testData.members), version)
+	}
+}
+
+// Record which failed to be written is not kept, log which can't be cut back rejects every next change.
+func TestWALWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	repository := newTestWAL(t, dir, WALOptions{})
+	states := saveTestChanges(t, repository)
+	logPath := filepath.Join(dir, walLogName)
+	before, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := repository.log
+	if repository.log, err = os.Open(logPath); err != nil { // neither written nor truncated
+		t.Fatal(err)
+	}
+	defer func() { repository.log.Close(); repository.log = log }()
+	if err := repository.Delete(context.Background(), 0); err == nil || strings.Contains(err.Error(), "log is broken") {
+		t.Errorf("expected write error, got %v", err)
+	}
+	if err := repository.Delete(context.Background(), 0); err == nil || !strings.Contains(err.Error(), "log is broken") {
+		t.Errorf("expected broken log, got %v", err)
+	}
+	if after, err := os.Stat(logPath); err != nil || after.Size() != before.Size() {
+		t.Errorf("expected log of %d bytes, got %v", before.Size(), err)
+	}
+	users, _ := repository.Users(0)
+	sameEntries(t, states[2], users)
+}